@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	AccountFilterAll      = "all"      // Every account
+	AccountFilterEOA      = "eoa"      // Accounts without code
+	AccountFilterContract = "contract" // Accounts with code, including EOAs with an EIP-7702 delegation
+)
+
+// AccountFilter decides which scanned accounts are saved.
+type AccountFilter struct {
+	mode              string
+	minBalance        *big.Int
+	maxBalance        *big.Int
+	minNonce          uint64
+	maxNonce          uint64
+	codeHashes        map[string]bool
+	excludeCodeHashes map[string]bool
+	addresses         map[string]bool
+}
+
+// NewAccountFilter creates the account filter of the configuration. The
+// addresses of the filter section, when set, restrict the saved accounts to them.
+func NewAccountFilter(config *Config) (*AccountFilter, error) {
+	filterConfig := config.Scan.AccountScanConfig.Filter
+
+	// Without a mode the original behaviour applies: contracts with a non-zero balance.
+	if filterConfig.Mode == "" {
+		filterConfig.Mode = DefaultAccountFilterMode
+		if filterConfig.MinBalance == "" {
+			filterConfig.MinBalance = DefaultAccountMinBalance
+		}
+	}
+
+	switch filterConfig.Mode {
+	case AccountFilterAll, AccountFilterEOA, AccountFilterContract:
+	default:
+		return nil, fmt.Errorf("unknown account filter mode %q", filterConfig.Mode)
+	}
+
+	filter := &AccountFilter{
+		mode:              filterConfig.Mode,
+		minNonce:          filterConfig.MinNonce,
+		maxNonce:          filterConfig.MaxNonce,
+		codeHashes:        lowerCaseSet(filterConfig.CodeHashes),
+		excludeCodeHashes: lowerCaseSet(filterConfig.ExcludeCodeHashes),
+		addresses:         lowerCaseSet(config.Filter.Addresses),
+	}
+
+	var err error
+
+	if filter.minBalance, err = parseBalance(filterConfig.MinBalance); err != nil {
+		return nil, fmt.Errorf("invalid min balance: %w", err)
+	}
+
+	if filter.maxBalance, err = parseBalance(filterConfig.MaxBalance); err != nil {
+		return nil, fmt.Errorf("invalid max balance: %w", err)
+	}
+
+	return filter, nil
+}
+
+// Matches reports whether the account passes the filter.
+func (f *AccountFilter) Matches(address string, account RpcAccount) (bool, error) {
+	switch f.mode {
+	case AccountFilterEOA:
+		if account.IsContract {
+			return false, nil
+		}
+	case AccountFilterContract:
+		if !account.IsContract {
+			return false, nil
+		}
+	}
+
+	if len(f.addresses) > 0 && !f.addresses[strings.ToLower(address)] {
+		return false, nil
+	}
+
+	codeHash := strings.ToLower(account.CodeHash)
+
+	if len(f.codeHashes) > 0 && !f.codeHashes[codeHash] {
+		return false, nil
+	}
+
+	if f.excludeCodeHashes[codeHash] {
+		return false, nil
+	}
+
+	if account.Nonce < f.minNonce || (f.maxNonce > 0 && account.Nonce > f.maxNonce) {
+		return false, nil
+	}
+
+	if f.minBalance != nil || f.maxBalance != nil {
+		balance, err := parseBalance(account.Balance)
+		if err != nil || balance == nil {
+			return false, fmt.Errorf("invalid balance %q for account %s", account.Balance, address)
+		}
+
+		if f.minBalance != nil && balance.Cmp(f.minBalance) < 0 {
+			return false, nil
+		}
+
+		if f.maxBalance != nil && balance.Cmp(f.maxBalance) > 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// String describes the filter for logging.
+func (f *AccountFilter) String() string {
+	parts := []string{"mode " + f.mode}
+
+	if f.minBalance != nil {
+		parts = append(parts, "min balance "+f.minBalance.String())
+	}
+	if f.maxBalance != nil {
+		parts = append(parts, "max balance "+f.maxBalance.String())
+	}
+	if f.minNonce > 0 {
+		parts = append(parts, fmt.Sprintf("min nonce %d", f.minNonce))
+	}
+	if f.maxNonce > 0 {
+		parts = append(parts, fmt.Sprintf("max nonce %d", f.maxNonce))
+	}
+	if len(f.codeHashes) > 0 {
+		parts = append(parts, fmt.Sprintf("%d code hashes", len(f.codeHashes)))
+	}
+	if len(f.excludeCodeHashes) > 0 {
+		parts = append(parts, fmt.Sprintf("%d excluded code hashes", len(f.excludeCodeHashes)))
+	}
+	if len(f.addresses) > 0 {
+		parts = append(parts, fmt.Sprintf("%d addresses", len(f.addresses)))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// parseBalance parses a decimal or 0x-prefixed hex balance in wei. An empty
+// string means no balance and returns nil.
+func parseBalance(balance string) (*big.Int, error) {
+	if balance == "" {
+		return nil, nil
+	}
+
+	value, ok := new(big.Int), false
+	if strings.HasPrefix(balance, "0x") {
+		value, ok = value.SetString(balance[2:], 16)
+	} else {
+		value, ok = value.SetString(balance, 10)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%q is not a number", balance)
+	}
+
+	return value, nil
+}
+
+// lowerCaseSet returns the lower case values as a set.
+func lowerCaseSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+
+	for _, value := range values {
+		set[strings.ToLower(value)] = true
+	}
+
+	return set
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Code hash of accounts without code.
+const nonContractCodeHash = "0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"
+
+// partitionCount returns the configured number of key ranges, falling back to the default.
+func (a AccountScanConfig) partitionCount() int {
+	if a.Partitions == 0 {
+		return DefaultAccountPartitions
+	}
+
+	return int(a.Partitions)
+}
+
+// accountKeyToBigInt converts a Base64 encoded trie key to a *big.Int*. Keys
+// shorter than 32 bytes are prefixes and are padded with zeros on the right,
+// the way the node interprets them.
+func accountKeyToBigInt(key string) (*big.Int, error) {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding base64 key %q: %w", key, err)
+	}
+
+	if len(decoded) > 32 {
+		return nil, fmt.Errorf("key %q is longer than 32 bytes", key)
+	}
+
+	padded := make([]byte, 32)
+	copy(padded, decoded)
+
+	return new(big.Int).SetBytes(padded), nil
+}
+
+// partitionAccountKeySpace splits the trie key space from startKey to endKey
+// into count disjoint ranges of equal size. An empty endKey means the end of
+// the key space, in which case the last range has no end key.
+func partitionAccountKeySpace(startKey string, endKey string, count int) ([]AccountPartitionCheckpoint, error) {
+	start, err := accountKeyToBigInt(startKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start key: %w", err)
+	}
+
+	end := new(big.Int).Lsh(big.NewInt(1), 256)
+	if endKey != "" {
+		if end, err = accountKeyToBigInt(endKey); err != nil {
+			return nil, fmt.Errorf("invalid end key: %w", err)
+		}
+	}
+
+	if start.Cmp(end) >= 0 {
+		return nil, fmt.Errorf("start key %q is not before end key %q", startKey, endKey)
+	}
+
+	size := new(big.Int).Sub(end, start)
+	size.Div(size, big.NewInt(int64(count)))
+
+	if size.Sign() == 0 {
+		return nil, fmt.Errorf("cannot split the key space from %q to %q into %d partitions", startKey, endKey, count)
+	}
+
+	partitions := make([]AccountPartitionCheckpoint, count)
+
+	for i := range partitions {
+		from := new(big.Int).Mul(size, big.NewInt(int64(i)))
+		from.Add(from, start)
+
+		partitions[i].StartKey = BigIntToBase64Key(from)
+		if i == 0 {
+			partitions[i].StartKey = startKey
+		}
+
+		partitions[i].NextKey = partitions[i].StartKey
+
+		partitions[i].EndKey = endKey
+		if i < count-1 {
+			partitions[i].EndKey = BigIntToBase64Key(new(big.Int).Add(from, size))
+		}
+	}
+
+	return partitions, nil
+}
+
+// accountRangeScan holds the state shared by the partitions of an account scan.
+type accountRangeScan struct {
+	client         *RpcPool
+	config         *Config
+	filter         *AccountFilter
+	maxAccounts    uint64
+	checkpoint     *AccountScanCheckpoint
+	checkpointPath string
+
+	mu       sync.Mutex
+	scanned  atomic.Uint64 // Accounts scanned by all partitions, used for the max accounts limit
+	stopped  atomic.Bool
+	lastLog  time.Time
+	lastPage uint64
+}
+
+// run scans all unfinished partitions in parallel, writing each one to its own
+// file in the output directory. The first error stops all partitions.
+func (s *accountRangeScan) run() error {
+	s.scanned.Store(s.checkpoint.totals().ScannedAccounts)
+	s.lastLog = time.Now()
+
+	// All outputs are opened before the first partition starts, so that no
+	// partition is left running when one of them cannot be opened.
+	writers := make([]*JSONLWriter, len(s.checkpoint.Partitions))
+
+	for i, partition := range s.checkpoint.Partitions {
+		writer, err := OpenJSONLWriter(filepath.Join(s.config.Scan.OutputDir, partition.File), partition.OutputBytes)
+		if err != nil {
+			for _, opened := range writers[:i] {
+				opened.Close()
+			}
+
+			return fmt.Errorf("failed to open accounts output: %w", err)
+		}
+
+		writers[i] = writer
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(s.checkpoint.Partitions))
+
+	for i, partition := range s.checkpoint.Partitions {
+		writer := writers[i]
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer writer.Close()
+
+			if err := s.scanPartition(i, partition, writer); err != nil {
+				errs[i] = fmt.Errorf("partition %d: %w", i+1, err)
+				s.stopped.Store(true)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanPartition pages through the key range of a partition until the node
+// returns no next key, the next key reaches the end of the range or the scan
+// is stopped. Only the current page is kept in memory.
+func (s *accountRangeScan) scanPartition(index int, state AccountPartitionCheckpoint, writer *JSONLWriter) error {
+	accountScan := s.config.Scan.AccountScanConfig
+
+	var end *big.Int
+	if state.EndKey != "" {
+		key, err := accountKeyToBigInt(state.EndKey)
+		if err != nil {
+			return fmt.Errorf("invalid end key: %w", err)
+		}
+
+		end = key
+	}
+
+	var last *big.Int
+	if state.LastKey != "" {
+		key, err := accountKeyToBigInt(state.LastKey)
+		if err != nil {
+			return fmt.Errorf("invalid last key: %w", err)
+		}
+
+		last = key
+	}
+
+	for !state.Done && !s.stopped.Load() {
+		current, err := accountKeyToBigInt(state.NextKey)
+		if err != nil {
+			return fmt.Errorf("invalid scan key: %w", err)
+		}
+
+		var raw json.RawMessage
+		err = CallWithRetry(s.client, s.config.Rpc.Retry, &raw, "debug_accountRange", accountScan.BlockNumber, state.NextKey, accountScan.BatchSize, true, true)
+		if err != nil {
+			return fmt.Errorf("failed to fetch accounts at key %s: %w", state.NextKey, err)
+		}
+
+		var result RpcAccountPageResult
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return fmt.Errorf("failed to unmarshal JSON: %w", err)
+		}
+
+		// An empty next key means that this is the last page of the trie.
+		completedScan := result.Next == ""
+
+		if !completedScan {
+			next, err := accountKeyToBigInt(result.Next)
+			if err != nil {
+				return fmt.Errorf("invalid next key: %w", err)
+			}
+
+			// Without this the scan would loop forever on a node that does not move forward.
+			if next.Cmp(current) <= 0 {
+				return fmt.Errorf("node returned next key %s which is not after the scan key %q", result.Next, state.NextKey)
+			}
+
+			completedScan = end != nil && next.Cmp(end) >= 0
+		}
+
+		// Key of the first account left out when the maximum number of accounts is reached
+		var stoppedAt *big.Int
+
+		// Process each account in the batch, in trie key order.
+		for _, record := range sortedAccountRecords(result.Accounts) {
+			address, account := record.Address, record.RpcAccount
+
+			key, err := HexToBigInt(account.Key)
+			if err != nil || key == nil {
+				return fmt.Errorf("invalid key %q for account %s", account.Key, address)
+			}
+
+			// Pages may overlap, so accounts that were already handled are skipped.
+			if last != nil && key.Cmp(last) <= 0 {
+				continue
+			}
+
+			// The remaining accounts belong to the next partition.
+			if end != nil && key.Cmp(end) >= 0 {
+				completedScan = true
+				break
+			}
+
+			if s.scanned.Add(1) > s.maxAccounts {
+				log.Printf("Reached the maximum number of accounts to scan: %d !\n", s.maxAccounts)
+				s.stopped.Store(true)
+				stoppedAt = key
+				break
+			}
+
+			state.ScannedAccounts++
+
+			// Without the code, an EIP-7702 delegation cannot be told from contract code.
+			account.IsContract = account.CodeHash != nonContractCodeHash
+			if account.IsContract {
+				state.Contracts++
+			} else {
+				state.NonContracts++
+			}
+
+			matches, err := s.filter.Matches(address, account)
+			if err != nil {
+				return err
+			}
+
+			if matches {
+				if err := writer.Write(AccountRecord{Address: address, RpcAccount: account}); err != nil {
+					return fmt.Errorf("failed to save account %s: %w", address, err)
+				}
+
+				state.WrittenAccounts++
+			}
+
+			last = key
+			state.LastKey = BigIntToBase64Key(key)
+		}
+
+		offset, err := writer.Sync()
+		if err != nil {
+			return fmt.Errorf("failed to save accounts to file: %w", err)
+		}
+
+		state.Pages++
+		state.NextKey = result.Next
+		state.Done = completedScan
+		state.OutputBytes = offset
+
+		// The rest of the page was not handled, a resumed scan starts there.
+		if stoppedAt != nil {
+			state.NextKey = BigIntToBase64Key(stoppedAt)
+			state.Done = false
+		}
+
+		if err := s.savePartition(index, state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// savePartition records the progress of a partition in the checkpoint and
+// periodically logs the progress of the whole scan.
+func (s *accountRangeScan) savePartition(index int, state AccountPartitionCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoint.Partitions[index] = state
+	s.checkpoint.UpdatedAt = time.Now().Unix()
+
+	if err := SaveCheckpoint(s.checkpoint, s.checkpointPath); err != nil {
+		return err
+	}
+
+	totals := s.checkpoint.totals()
+
+	if totals.Pages-s.lastPage >= 20 {
+		done := 0
+		for _, partition := range s.checkpoint.Partitions {
+			if partition.Done {
+				done++
+			}
+		}
+
+		log.Printf("===========================================\n")
+		log.Printf("Total: %d accounts scanned (%d contracts, %d non-contracts), %d written\n",
+			totals.ScannedAccounts, totals.Contracts, totals.NonContracts, totals.WrittenAccounts)
+		log.Printf("Output size: %.2f MB\n", float64(totals.OutputBytes)/(1024*1024))
+		log.Printf("Partitions done: %d of %d\n", done, len(s.checkpoint.Partitions))
+		log.Printf("Time elapsed: %s\n", time.Since(s.lastLog))
+		log.Printf("Pages per second: %.2f\n", float64(totals.Pages-s.lastPage)/time.Since(s.lastLog).Seconds())
+		log.Printf("===========================================\n")
+
+		s.lastPage = totals.Pages
+		s.lastLog = time.Now()
+	}
+
+	return nil
+}
+
+// mergeAccountPartitions concatenates the partition files, which are each sorted
+// by key and cover increasing key ranges, into a single file in key order. The
+// partition files are removed unless they are kept to resume the scan.
+func mergeAccountPartitions(dir string, partitions []AccountPartitionCheckpoint, path string, keepPartitions bool) error {
+	if len(partitions) == 1 && !keepPartitions {
+		return os.Rename(filepath.Join(dir, partitions[0].File), path)
+	}
+
+	output, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	defer output.Close()
+
+	for _, partition := range partitions {
+		input, err := os.Open(filepath.Join(dir, partition.File))
+		if err != nil {
+			return fmt.Errorf("failed to open partition file: %w", err)
+		}
+
+		_, err = io.CopyN(output, input, partition.OutputBytes)
+		input.Close()
+
+		if err != nil {
+			return fmt.Errorf("failed to copy partition file %s: %w", partition.File, err)
+		}
+	}
+
+	if err := output.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if keepPartitions {
+		return nil
+	}
+
+	for _, partition := range partitions {
+		os.Remove(filepath.Join(dir, partition.File))
+	}
+
+	return nil
+}
+
+// uncoveredAccountKeys checks that the partitions, together, covered the whole
+// key range of the scan. It returns a description of the first range that
+// was not scanned, or an empty string when the key range was fully covered.
+func uncoveredAccountKeys(partitions []AccountPartitionCheckpoint) string {
+	for i, partition := range partitions {
+		if i > 0 && partition.StartKey != partitions[i-1].EndKey {
+			return fmt.Sprintf("keys %s to %s are not assigned to any partition", partitions[i-1].EndKey, partition.StartKey)
+		}
+
+		if !partition.Done {
+			return fmt.Sprintf("partition %d stopped at key %s before its end key %q", i+1, partition.NextKey, partition.EndKey)
+		}
+	}
+
+	return ""
+}
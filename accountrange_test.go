@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testAccountKey returns the Base64 trie key of the given hex number.
+func testAccountKey(hex string) string {
+	number, ok := new(big.Int).SetString(hex, 16)
+	if !ok {
+		panic("invalid hex number " + hex)
+	}
+
+	return BigIntToBase64Key(number)
+}
+
+func TestPartitionAccountKeySpace(t *testing.T) {
+	zero := testAccountKey("0")
+	quarter := testAccountKey("4" + strings.Repeat("0", 63))
+	half := testAccountKey("8" + strings.Repeat("0", 63))
+	threeQuarters := testAccountKey("c" + strings.Repeat("0", 63))
+	sevenEighths := testAccountKey("e" + strings.Repeat("0", 63))
+
+	tests := []struct {
+		name       string
+		startKey   string
+		endKey     string
+		count      int
+		wantStarts []string
+		wantErr    bool
+	}{
+		{name: "single partition", startKey: zero, count: 1, wantStarts: []string{zero}},
+		{name: "quarters", startKey: zero, count: 4, wantStarts: []string{zero, quarter, half, threeQuarters}},
+		{name: "from the middle", startKey: half, count: 2, wantStarts: []string{half, threeQuarters}},
+		{name: "key prefix", startKey: "wA==", count: 2, wantStarts: []string{"wA==", sevenEighths}},
+		{name: "empty start key", startKey: "", count: 2, wantStarts: []string{"", half}},
+		{name: "end key", startKey: zero, endKey: half, count: 2, wantStarts: []string{zero, quarter}},
+		{name: "start and end keys", startKey: quarter, endKey: threeQuarters, count: 2, wantStarts: []string{quarter, half}},
+		{name: "end key prefix", startKey: zero, endKey: "gA==", count: 2, wantStarts: []string{zero, quarter}},
+		{name: "invalid start key", startKey: "not base64!", count: 2, wantErr: true},
+		{name: "invalid end key", startKey: zero, endKey: "not base64!", count: 2, wantErr: true},
+		{name: "start key too long", startKey: strings.Repeat("A", 44), count: 2, wantErr: true},
+		{name: "end key before start key", startKey: half, endKey: quarter, count: 1, wantErr: true},
+		{name: "empty key range", startKey: half, endKey: half, count: 1, wantErr: true},
+		{name: "too many partitions", startKey: testAccountKey(strings.Repeat("f", 64)), count: 2, wantErr: true},
+	}
+
+	for _, test := range tests {
+		partitions, err := partitionAccountKeySpace(test.startKey, test.endKey, test.count)
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %d partitions, want an error", test.name, len(partitions))
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		starts := make([]string, 0, len(partitions))
+		for _, partition := range partitions {
+			starts = append(starts, partition.StartKey)
+		}
+
+		if !slices.Equal(starts, test.wantStarts) {
+			t.Errorf("%s: start keys %v, want %v", test.name, starts, test.wantStarts)
+			continue
+		}
+
+		for i, partition := range partitions {
+			wantEnd := test.endKey
+			if i < len(partitions)-1 {
+				wantEnd = partitions[i+1].StartKey
+			}
+
+			if partition.EndKey != wantEnd || partition.NextKey != partition.StartKey || partition.Done {
+				t.Errorf("%s: partition %d is %+v, want the end key %q and the next key at its start", test.name, i, partition, wantEnd)
+			}
+		}
+	}
+}
+
+func TestUncoveredAccountKeys(t *testing.T) {
+	zero := testAccountKey("0")
+	quarter := testAccountKey("4" + strings.Repeat("0", 63))
+	half := testAccountKey("8" + strings.Repeat("0", 63))
+
+	tests := []struct {
+		name       string
+		partitions []AccountPartitionCheckpoint
+		want       string // Prefix of the description, empty when the keys are covered
+	}{
+		{
+			name:       "single partition done",
+			partitions: []AccountPartitionCheckpoint{{StartKey: zero, Done: true}},
+		},
+		{
+			name: "all partitions done",
+			partitions: []AccountPartitionCheckpoint{
+				{StartKey: zero, EndKey: quarter, Done: true},
+				{StartKey: quarter, EndKey: half, Done: true},
+				{StartKey: half, Done: true},
+			},
+		},
+		{
+			name: "partition stopped",
+			partitions: []AccountPartitionCheckpoint{
+				{StartKey: zero, EndKey: quarter, Done: true},
+				{StartKey: quarter, EndKey: half, NextKey: "MA==", Done: false},
+				{StartKey: half, Done: true},
+			},
+			want: "partition 2 stopped at key MA==",
+		},
+		{
+			name: "last partition stopped",
+			partitions: []AccountPartitionCheckpoint{
+				{StartKey: zero, EndKey: half, Done: true},
+				{StartKey: half, NextKey: "wA==", Done: false},
+			},
+			want: "partition 2 stopped at key wA==",
+		},
+		{
+			name: "gap between partitions",
+			partitions: []AccountPartitionCheckpoint{
+				{StartKey: zero, EndKey: quarter, Done: true},
+				{StartKey: half, Done: true},
+			},
+			want: "keys " + quarter + " to " + half + " are not assigned",
+		},
+	}
+
+	for _, test := range tests {
+		got := uncoveredAccountKeys(test.partitions)
+
+		if test.want == "" && got != "" {
+			t.Errorf("%s: %q, want the keys to be covered", test.name, got)
+		}
+
+		if test.want != "" && !strings.HasPrefix(got, test.want) {
+			t.Errorf("%s: %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// testAccountRangeService answers debug_accountRange from a list of accounts in
+// key order, and eth_blockNumber for the health checks.
+type testAccountRangeService struct {
+	accounts []AccountRecord
+	overlap  bool // Whether each page starts with the last account of the previous page
+}
+
+func (s *testAccountRangeService) BlockNumber() hexutil.Uint64 {
+	return 1
+}
+
+func (s *testAccountRangeService) AccountRange(block uint64, start string, maxResults int, nocode bool, nostorage bool) (*RpcAccountPageResult, error) {
+	startKey, err := accountKeyToBigInt(start)
+	if err != nil {
+		return nil, err
+	}
+
+	first := len(s.accounts)
+	for i, record := range s.accounts {
+		if key, _ := HexToBigInt(record.Key); key.Cmp(startKey) >= 0 {
+			first = i
+			break
+		}
+	}
+
+	last := min(first+maxResults, len(s.accounts))
+	result := &RpcAccountPageResult{Accounts: make(map[string]RpcAccount)}
+
+	for _, record := range s.accounts[first:last] {
+		result.Accounts[record.Address] = record.RpcAccount
+	}
+
+	next := last
+	if s.overlap {
+		next = last - 1
+	}
+
+	if last < len(s.accounts) {
+		key, _ := HexToBigInt(s.accounts[next].Key)
+		result.Next = BigIntToBase64Key(key)
+	}
+
+	return result, nil
+}
+
+// testAccountScan starts a node serving count accounts spread over the key
+// space and returns the configuration of a scan of all of them.
+func testAccountScan(t *testing.T, service *testAccountRangeService, count int, partitions uint64) *Config {
+	for i := range count {
+		key := new(big.Int).Lsh(big.NewInt(int64(i)), 252)
+		key.Add(key, big.NewInt(1))
+
+		service.accounts = append(service.accounts, AccountRecord{
+			Address:    fmt.Sprintf("0x%040x", i+1),
+			RpcAccount: RpcAccount{Balance: "0x1", CodeHash: nonContractCodeHash, Key: fmt.Sprintf("0x%064x", key)},
+		})
+	}
+
+	server := rpc.NewServer()
+	for _, name := range []string{"eth", "debug"} {
+		if err := server.RegisterName(name, service); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	t.Cleanup(server.Stop)
+
+	config := new(Config)
+	config.Rpc.Url = httpServer.URL
+	config.Scan.OutputDir = "output"
+	config.Scan.AccountScanConfig = AccountScanConfig{
+		BlockNumber: 1,
+		StartKey:    BigIntToBase64Key(big.NewInt(0)),
+		BatchSize:   3,
+		Partitions:  partitions,
+		Filter:      AccountFilterConfig{Mode: AccountFilterAll},
+	}
+
+	return config
+}
+
+// runAccountScan scans the partitions of the checkpoint and returns the keys
+// of the accounts saved by all partitions, in order.
+func runAccountScan(t *testing.T, config *Config, checkpoint *AccountScanCheckpoint, maxAccounts uint64) []string {
+	client, err := NewRpcPool(config.Rpc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	filter, err := NewAccountFilter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scan := &accountRangeScan{
+		client:         client,
+		config:         config,
+		filter:         filter,
+		maxAccounts:    maxAccounts,
+		checkpoint:     checkpoint,
+		checkpointPath: filepath.Join(config.Scan.OutputDir, "accounts.checkpoint.json"),
+	}
+
+	if err := scan.run(); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make([]string, 0)
+
+	for _, partition := range checkpoint.Partitions {
+		err := ReadJSONL(filepath.Join(config.Scan.OutputDir, partition.File), func(record AccountRecord) error {
+			keys = append(keys, record.Key)
+			return nil
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return keys
+}
+
+func TestAccountRangeScan(t *testing.T) {
+	tests := []struct {
+		name       string
+		overlap    bool
+		partitions uint64
+	}{
+		{name: "single partition", partitions: 1},
+		{name: "partitions", partitions: 2},
+		{name: "overlapping pages", overlap: true, partitions: 1},
+		{name: "overlapping pages in partitions", overlap: true, partitions: 2},
+	}
+
+	for _, test := range tests {
+		t.Chdir(t.TempDir())
+
+		service := &testAccountRangeService{overlap: test.overlap}
+		config := testAccountScan(t, service, 10, test.partitions)
+
+		checkpoint, err := newAccountScanCheckpoint(config, "accounts")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys := runAccountScan(t, config, checkpoint, math.MaxUint64)
+
+		want := make([]string, 0)
+		for _, record := range service.accounts {
+			want = append(want, record.Key)
+		}
+
+		if !slices.Equal(keys, want) {
+			t.Errorf("%s: saved %d accounts %v, want %d accounts %v", test.name, len(keys), keys, len(want), want)
+		}
+
+		if uncovered := uncoveredAccountKeys(checkpoint.Partitions); uncovered != "" {
+			t.Errorf("%s: %s", test.name, uncovered)
+		}
+
+		if scanned := checkpoint.totals().ScannedAccounts; scanned != uint64(len(want)) {
+			t.Errorf("%s: %d accounts scanned, want %d", test.name, scanned, len(want))
+		}
+	}
+}
+
+func TestAccountRangeScanMaxAccounts(t *testing.T) {
+	tests := []struct {
+		name        string
+		partitions  uint64
+		maxAccounts uint64
+	}{
+		{name: "stop within a page", partitions: 1, maxAccounts: 4},
+		{name: "stop at the end of a page", partitions: 1, maxAccounts: 6},
+		{name: "stop within a page in partitions", partitions: 2, maxAccounts: 5},
+	}
+
+	for _, test := range tests {
+		t.Chdir(t.TempDir())
+
+		service := &testAccountRangeService{}
+		config := testAccountScan(t, service, 10, test.partitions)
+
+		checkpoint, err := newAccountScanCheckpoint(config, "accounts")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys := runAccountScan(t, config, checkpoint, test.maxAccounts)
+
+		if uint64(len(keys)) > test.maxAccounts {
+			t.Errorf("%s: saved %d accounts, want at most %d", test.name, len(keys), test.maxAccounts)
+		}
+
+		if uncoveredAccountKeys(checkpoint.Partitions) == "" {
+			t.Errorf("%s: key space covered after stopping at %d accounts", test.name, test.maxAccounts)
+		}
+
+		// Resuming with a higher maximum scans the accounts left out.
+		keys = runAccountScan(t, config, checkpoint, math.MaxUint64)
+
+		want := make([]string, 0)
+		for _, record := range service.accounts {
+			want = append(want, record.Key)
+		}
+
+		if !slices.Equal(keys, want) {
+			t.Errorf("%s: saved %d accounts %v after resuming, want %d accounts %v", test.name, len(keys), keys, len(want), want)
+		}
+
+		if uncovered := uncoveredAccountKeys(checkpoint.Partitions); uncovered != "" {
+			t.Errorf("%s: %s", test.name, uncovered)
+		}
+	}
+}
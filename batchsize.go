@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Number of consecutive healthy batches before the batch size grows again.
+const batchGrowthThreshold = 10
+
+// Substrings of error messages signalling that a batch was too large or too slow.
+var batchSizeMessages = []string{
+	"batch too large",
+	"batch size",
+	"batch limit",
+	"too many batch",
+	"response too large",
+	"request entity too large",
+	"payload too large",
+	"timed out",
+	"timeout",
+	"deadline exceeded",
+}
+
+// JSON-RPC error codes signalling that a batch was too large or too slow.
+var batchSizeCodes = map[int]bool{
+	-32002: true, // Request timed out
+	-32003: true, // Response too large
+}
+
+// AdaptiveBatchSize tracks the effective batch size of a scanner. It is halved
+// when the node rejects or times out on a batch and grows back toward the
+// configured ceiling while responses stay healthy. It is safe for concurrent use.
+type AdaptiveBatchSize struct {
+	mu      sync.Mutex
+	size    int
+	ceiling int
+	healthy int // Consecutive healthy batches at the current size
+}
+
+// NewAdaptiveBatchSize creates a batch size starting at the configured ceiling.
+func NewAdaptiveBatchSize(ceiling uint64) *AdaptiveBatchSize {
+	if ceiling == 0 {
+		ceiling = DefaultBatchSize
+	}
+
+	return &AdaptiveBatchSize{size: int(ceiling), ceiling: int(ceiling)}
+}
+
+// Size returns the current effective batch size.
+func (a *AdaptiveBatchSize) Size() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.size
+}
+
+// Shrink halves the batch size after a batch of failedSize elements was rejected.
+func (a *AdaptiveBatchSize) Shrink(failedSize int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	size := failedSize / 2
+	if size < 1 {
+		size = 1
+	}
+
+	if size < a.size {
+		log.Printf("Batch of %d rejected by the node, shrinking batch size to %d\n", failedSize, size)
+		a.size = size
+	}
+
+	a.healthy = 0
+}
+
+// Grow records a healthy batch and doubles the batch size, up to the ceiling,
+// after enough consecutive healthy batches.
+func (a *AdaptiveBatchSize) Grow() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.size >= a.ceiling {
+		return
+	}
+
+	a.healthy++
+	if a.healthy < batchGrowthThreshold {
+		return
+	}
+
+	a.size *= 2
+	if a.size > a.ceiling {
+		a.size = a.ceiling
+	}
+
+	a.healthy = 0
+}
+
+// isBatchSizeError reports whether the error means that the batch was too
+// large for the node or took too long to answer.
+func isBatchSizeError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusRequestEntityTooLarge, http.StatusRequestTimeout, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && batchSizeCodes[rpcErr.ErrorCode()] {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, batchSizeMessage := range batchSizeMessages {
+		if strings.Contains(message, batchSizeMessage) {
+			return true
+		}
+	}
+
+	return false
+}
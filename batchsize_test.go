@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestAdaptiveBatchSize(t *testing.T) {
+	const grow = 0 // A healthy batch
+
+	tests := []struct {
+		name    string
+		ceiling uint64
+		steps   []int // Size of a rejected batch, or grow for a healthy batch
+		want    int
+	}{
+		{name: "default ceiling", ceiling: 0, want: DefaultBatchSize},
+		{name: "initial size", ceiling: 100, want: 100},
+		{name: "shrink", ceiling: 100, steps: []int{100}, want: 50},
+		{name: "shrink twice", ceiling: 100, steps: []int{100, 50}, want: 25},
+		{name: "shrink to one", ceiling: 100, steps: []int{1}, want: 1},
+		{name: "stale rejection does not grow", ceiling: 100, steps: []int{20, 100}, want: 10},
+		{name: "no growth before threshold", ceiling: 100, steps: append([]int{100}, repeat(grow, batchGrowthThreshold-1)...), want: 50},
+		{name: "growth at threshold", ceiling: 100, steps: append([]int{100, 50}, repeat(grow, batchGrowthThreshold)...), want: 50},
+		{name: "growth bounded by ceiling", ceiling: 100, steps: append([]int{60}, repeat(grow, 2*batchGrowthThreshold)...), want: 100},
+		{name: "rejection resets growth", ceiling: 100, steps: append(append([]int{100}, repeat(grow, batchGrowthThreshold-1)...), 100, grow), want: 50},
+	}
+
+	for _, test := range tests {
+		size := NewAdaptiveBatchSize(test.ceiling)
+
+		for _, step := range test.steps {
+			if step == grow {
+				size.Grow()
+			} else {
+				size.Shrink(step)
+			}
+		}
+
+		if got := size.Size(); got != test.want {
+			t.Errorf("%s: size %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIsBatchSizeError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: context.DeadlineExceeded, want: true},
+		{err: fmt.Errorf("batch failed: %w", context.DeadlineExceeded), want: true},
+		{err: rpc.HTTPError{StatusCode: 413}, want: true},
+		{err: rpc.HTTPError{StatusCode: 408}, want: true},
+		{err: rpc.HTTPError{StatusCode: 504}, want: true},
+		{err: rpc.HTTPError{StatusCode: 500, Status: "500 Internal Server Error"}, want: false},
+		{err: testRpcError{code: -32002, message: "request failed"}, want: true},
+		{err: testRpcError{code: -32003, message: "request failed"}, want: true},
+		{err: testRpcError{code: -32000, message: "Batch size too large"}, want: true},
+		{err: testRpcError{code: -32000, message: "header not found"}, want: false},
+		{err: errors.New("read tcp: i/o timeout"), want: true},
+		{err: errors.New("connection reset by peer"), want: false},
+	}
+
+	for _, test := range tests {
+		if got := isBatchSizeError(test.err); got != test.want {
+			t.Errorf("isBatchSizeError(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func repeat(value int, count int) []int {
+	values := make([]int, count)
+	for i := range values {
+		values[i] = value
+	}
+
+	return values
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	OutputFormatJSON  = "json"  // A single JSON array written at the end of the scan
+	OutputFormatJSONL = "jsonl" // Rotated JSON lines files listed in a manifest
+)
+
+// outputFormat returns the configured output format, falling back to a single JSON file.
+func (b BlockScanConfig) outputFormat() string {
+	if b.OutputFormat == "" {
+		return OutputFormatJSON
+	}
+
+	return b.OutputFormat
+}
+
+// BlockFileEntry describes one file of a block stream and the blocks it holds.
+// File is relative to the directory of the manifest.
+type BlockFileEntry struct {
+	File      string `json:"file"`
+	FromBlock uint64 `json:"fromBlock"`
+	ToBlock   uint64 `json:"toBlock"`
+	Blocks    uint64 `json:"blocks"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// BlockManifest lists the files of a streamed block scan in block order.
+type BlockManifest struct {
+	FromBlock   uint64           `json:"fromBlock"`
+	ToBlock     uint64           `json:"toBlock"`
+	Blocks      uint64           `json:"blocks"`
+	Files       []BlockFileEntry `json:"files"`
+	Withdrawals string           `json:"withdrawals,omitempty"` // File of the withdrawals of the range, if any
+}
+
+// BlockStreamWriter appends blocks as JSON lines and starts a new file
+// whenever the current one reaches the block or byte limit.
+type BlockStreamWriter struct {
+	dir          string
+	fileName     func(index int) string
+	rotateBlocks uint64
+	rotateBytes  int64
+	files        []BlockFileEntry
+	writer       *JSONLWriter
+}
+
+// OpenBlockStreamWriter opens a block stream in dir. The files of a previous run
+// (from a checkpoint) are kept and the last one is truncated to its recorded size.
+// A limit of 0 disables the corresponding rotation.
+func OpenBlockStreamWriter(dir string, fileName func(index int) string, rotateBlocks uint64, rotateBytes uint64, files []BlockFileEntry) (*BlockStreamWriter, error) {
+	w := &BlockStreamWriter{
+		dir:          dir,
+		fileName:     fileName,
+		rotateBlocks: rotateBlocks,
+		rotateBytes:  int64(rotateBytes),
+		files:        append([]BlockFileEntry{}, files...),
+	}
+
+	if len(w.files) == 0 {
+		return w, w.rotate()
+	}
+
+	last := w.files[len(w.files)-1]
+
+	writer, err := OpenJSONLWriter(filepath.Join(dir, last.File), last.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	w.writer = writer
+
+	return w, nil
+}
+
+// rotate closes the current file and starts the next one.
+func (w *BlockStreamWriter) rotate() error {
+	if w.writer != nil {
+		if err := w.writer.Close(); err != nil {
+			return err
+		}
+	}
+
+	entry := BlockFileEntry{File: w.fileName(len(w.files) + 1)}
+
+	writer, err := OpenJSONLWriter(filepath.Join(w.dir, entry.File), 0)
+	if err != nil {
+		return err
+	}
+
+	w.files = append(w.files, entry)
+	w.writer = writer
+
+	return nil
+}
+
+// WriteBlock appends the block to the current file, rotating it first if it is full.
+func (w *BlockStreamWriter) WriteBlock(block *BlockFull) error {
+	current := &w.files[len(w.files)-1]
+
+	full := (w.rotateBlocks > 0 && current.Blocks >= w.rotateBlocks) ||
+		(w.rotateBytes > 0 && current.Bytes >= w.rotateBytes)
+
+	if full {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+		current = &w.files[len(w.files)-1]
+	}
+
+	if err := w.writer.Write(block); err != nil {
+		return err
+	}
+
+	number := uint64(0)
+	if block.Number != nil {
+		number = block.Number.Uint64()
+	}
+
+	if current.Blocks == 0 {
+		current.FromBlock = number
+	}
+
+	current.ToBlock = number
+	current.Blocks++
+	current.Bytes = w.writer.Offset()
+
+	return nil
+}
+
+// Sync flushes the current file to disk and returns the entries of all files.
+func (w *BlockStreamWriter) Sync() ([]BlockFileEntry, error) {
+	offset, err := w.writer.Sync()
+	if err != nil {
+		return nil, err
+	}
+
+	w.files[len(w.files)-1].Bytes = offset
+
+	return append([]BlockFileEntry{}, w.files...), nil
+}
+
+// Files returns the entries of all files, including the blocks not flushed yet.
+func (w *BlockStreamWriter) Files() []BlockFileEntry {
+	return append([]BlockFileEntry{}, w.files...)
+}
+
+// Close flushes and closes the current file.
+func (w *BlockStreamWriter) Close() error {
+	return w.writer.Close()
+}
+
+// NewBlockManifest creates the manifest of a finished block stream.
+func NewBlockManifest(fromBlock uint64, toBlock uint64, files []BlockFileEntry) *BlockManifest {
+	manifest := &BlockManifest{FromBlock: fromBlock, ToBlock: toBlock, Files: files}
+
+	for _, file := range files {
+		manifest.Blocks += file.Blocks
+	}
+
+	return manifest
+}
+
+// WriteJSONArrayFromJSONL streams the values of a JSON lines file into a JSON
+// array file, with the same layout as SaveStructToJSONFile, without loading
+// all values into memory.
+func WriteJSONArrayFromJSONL[T any](jsonlPath string, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	count := 0
+
+	err = ReadJSONL(jsonlPath, func(value T) error {
+		data, err := json.MarshalIndent(value, "    ", "    ")
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+
+		separator := ",\n    "
+		if count == 0 {
+			separator = "[\n    "
+		}
+
+		count++
+
+		if _, err := writer.WriteString(separator); err != nil {
+			return err
+		}
+
+		_, err = writer.Write(data)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	closing := "\n]\n"
+	if count == 0 {
+		closing = "[]\n"
+	}
+
+	if _, err := writer.WriteString(closing); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// ReadBlocks passes every block of a block scan output to fn, in file order.
+// The output is either a JSON array file or the manifest of a JSON lines
+// stream (a file ending in .manifest.json), whose files are read one by one.
+func ReadBlocks(path string, fn func(block *BlockFull) error) error {
+	if !strings.HasSuffix(path, ".manifest.json") {
+		var blocks []*BlockFull
+
+		if err := JSONToStruct(path, &blocks); err != nil {
+			return fmt.Errorf("failed to load blocks from file: %w", err)
+		}
+
+		for _, block := range blocks {
+			if block == nil {
+				continue
+			}
+
+			if err := fn(block); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var manifest BlockManifest
+
+	if err := JSONToStruct(path, &manifest); err != nil {
+		return fmt.Errorf("failed to load block manifest: %w", err)
+	}
+
+	for _, file := range manifest.Files {
+		if err := ReadJSONL(filepath.Join(filepath.Dir(path), file.File), fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+const (
+	ChainBreakParentHash = "parentHash" // The parent hash is not the hash of the previous block
+	ChainBreakGap        = "gap"        // Blocks are missing before this block
+	ChainBreakOrder      = "order"      // The block does not come after the previous block
+	ChainBreakTrusted    = "trusted"    // The block does not match a trusted hash, or the trusted block is not in the range
+)
+
+// ChainBreak is a place where the scanned blocks do not form a single chain.
+type ChainBreak struct {
+	Kind        string   `json:"kind"`
+	BlockNumber *big.Int `json:"blockNumber"`
+	BlockHash   string   `json:"blockHash"`
+	Expected    string   `json:"expected"`       // Hash (or block number for gaps and order) the block should have
+	Found       string   `json:"found"`          // Value found in the block
+	File        string   `json:"file,omitempty"` // Block file or manifest the block was read from
+}
+
+// ChainReport lists the breaks found in the chain of one or more block scan outputs.
+type ChainReport struct {
+	FromBlock     uint64       `json:"fromBlock"`
+	ToBlock       uint64       `json:"toBlock"`
+	Blocks        int          `json:"blocks"`
+	Files         []string     `json:"files"`
+	TrustedBlocks int          `json:"trustedBlocks"` // Trusted hashes found in the range
+	Breaks        []ChainBreak `json:"breaks"`
+}
+
+// chainChecker follows a sequence of blocks in block order and records where
+// they do not form a chain.
+type chainChecker struct {
+	report  *ChainReport
+	trusted map[uint64]string
+	found   map[uint64]bool
+
+	previousNumber uint64
+	previousHash   string
+}
+
+// newChainChecker creates a checker for blocks that must contain the trusted blocks.
+func newChainChecker(trusted []TrustedBlock) (*chainChecker, error) {
+	checker := &chainChecker{
+		report:  &ChainReport{Files: make([]string, 0), Breaks: make([]ChainBreak, 0)},
+		trusted: make(map[uint64]string, len(trusted)),
+		found:   make(map[uint64]bool, len(trusted)),
+	}
+
+	for _, block := range trusted {
+		if err := validateHexData(block.Hash, 32); err != nil {
+			return nil, fmt.Errorf("invalid trusted hash of block %d: %w", block.Number, err)
+		}
+
+		checker.trusted[block.Number] = strings.ToLower(block.Hash)
+	}
+
+	return checker, nil
+}
+
+// add checks the next block against the previous one and the trusted blocks.
+// A trusted block is also checked through the parent hash of the block after it,
+// so that the block before a range can anchor it.
+func (c *chainChecker) add(file string, block *BlockFull) {
+	if block.Number == nil {
+		return
+	}
+
+	number := block.Number.Uint64()
+
+	addBreak := func(kind string, expected string, found string) {
+		c.report.Breaks = append(c.report.Breaks, ChainBreak{
+			Kind: kind, BlockNumber: block.Number, BlockHash: block.Hash, Expected: expected, Found: found, File: file,
+		})
+	}
+
+	if c.report.Blocks > 0 {
+		switch {
+		case number <= c.previousNumber:
+			addBreak(ChainBreakOrder, fmt.Sprint(c.previousNumber+1), fmt.Sprint(number))
+		case number > c.previousNumber+1:
+			addBreak(ChainBreakGap, fmt.Sprint(c.previousNumber+1), fmt.Sprint(number))
+		case !strings.EqualFold(block.ParentHash, c.previousHash):
+			addBreak(ChainBreakParentHash, c.previousHash, block.ParentHash)
+		}
+	}
+
+	if hash, ok := c.trusted[number]; ok {
+		c.found[number] = true
+		if !strings.EqualFold(block.Hash, hash) {
+			addBreak(ChainBreakTrusted, hash, block.Hash)
+		}
+	}
+
+	if hash, ok := c.trusted[number-1]; number > 0 && ok && !c.found[number-1] {
+		c.found[number-1] = true
+		if !strings.EqualFold(block.ParentHash, hash) {
+			addBreak(ChainBreakTrusted, hash, block.ParentHash)
+		}
+	}
+
+	if c.report.Blocks == 0 || number < c.report.FromBlock {
+		c.report.FromBlock = number
+	}
+	if number > c.report.ToBlock {
+		c.report.ToBlock = number
+	}
+
+	c.report.Blocks++
+	c.previousNumber = number
+	c.previousHash = block.Hash
+}
+
+// finish reports the trusted blocks that were not found and returns the report.
+func (c *chainChecker) finish() *ChainReport {
+	for _, number := range slices.Sorted(maps.Keys(c.trusted)) {
+		if !c.found[number] {
+			c.report.Breaks = append(c.report.Breaks, ChainBreak{
+				Kind: ChainBreakTrusted, BlockNumber: new(big.Int).SetUint64(number), Expected: c.trusted[number],
+			})
+		}
+	}
+
+	c.report.TrustedBlocks = len(c.found)
+
+	return c.report
+}
+
+// CheckChainWithConfig checks that the blocks of the given block scan outputs
+// (JSON files or JSON lines manifests, in block order) form a single chain,
+// containing the trusted blocks of the configuration. The report is saved in
+// the output directory and an error is returned when the chain has breaks.
+func CheckChainWithConfig(config *Config, blockFiles []string) error {
+	checker, err := newChainChecker(config.Scan.BlockScanConfig.TrustedBlocks)
+	if err != nil {
+		return err
+	}
+
+	for _, blockFile := range blockFiles {
+		err := ReadBlocks(blockFile, func(block *BlockFull) error {
+			checker.add(blockFile, block)
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		checker.report.Files = append(checker.report.Files, blockFile)
+	}
+
+	report := checker.finish()
+
+	if report.Blocks == 0 {
+		return fmt.Errorf("no blocks found in %s", strings.Join(blockFiles, ", "))
+	}
+
+	reportPath := fmt.Sprintf("%s/chain_%d_to_%d.json", config.Scan.OutputDir, report.FromBlock, report.ToBlock)
+
+	if err := SaveStructToJSONFile(report, reportPath); err != nil {
+		return fmt.Errorf("failed to save chain report: %w", err)
+	}
+
+	log.Printf("Checked the chain of %d blocks in %d files (%d trusted blocks): %d breaks, see %s\n",
+		report.Blocks, len(report.Files), report.TrustedBlocks, len(report.Breaks), reportPath)
+
+	if len(report.Breaks) > 0 {
+		return fmt.Errorf("the blocks do not form a single chain: %d breaks, see %s", len(report.Breaks), reportPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testBlockHash returns the hash of block number in the test chain.
+func testBlockHash(number uint64) string {
+	return fmt.Sprintf("0x%064x", 0xb10c000+number)
+}
+
+// testChain returns the blocks from..to of a valid chain.
+func testChain(from uint64, to uint64) []*BlockFull {
+	blocks := make([]*BlockFull, 0)
+
+	for number := from; number <= to; number++ {
+		blocks = append(blocks, &BlockFull{
+			Number:     new(big.Int).SetUint64(number),
+			Hash:       testBlockHash(number),
+			ParentHash: testBlockHash(number - 1),
+		})
+	}
+
+	return blocks
+}
+
+func TestChainChecker(t *testing.T) {
+	otherHash := "0x" + strings.Repeat("ee", 32)
+
+	tests := []struct {
+		name        string
+		trusted     []TrustedBlock
+		modify      func(blocks []*BlockFull) []*BlockFull
+		wantBreaks  []string // Kinds of the breaks, in order
+		wantTrusted int
+	}{
+		{name: "chain"},
+		{
+			name:        "trusted block in range",
+			trusted:     []TrustedBlock{{Number: 12, Hash: testBlockHash(12)}},
+			wantTrusted: 1,
+		},
+		{
+			name:        "trusted hash in upper case",
+			trusted:     []TrustedBlock{{Number: 12, Hash: "0x" + strings.ToUpper(testBlockHash(12)[2:])}},
+			wantTrusted: 1,
+		},
+		{
+			name:        "trusted parent of the range",
+			trusted:     []TrustedBlock{{Number: 9, Hash: testBlockHash(9)}},
+			wantTrusted: 1,
+		},
+		{
+			name:        "trusted first and last blocks",
+			trusted:     []TrustedBlock{{Number: 10, Hash: testBlockHash(10)}, {Number: 20, Hash: testBlockHash(20)}},
+			wantTrusted: 2,
+		},
+		{
+			name:        "trusted hash mismatch",
+			trusted:     []TrustedBlock{{Number: 15, Hash: otherHash}},
+			wantBreaks:  []string{ChainBreakTrusted},
+			wantTrusted: 1,
+		},
+		{
+			name:        "trusted parent mismatch",
+			trusted:     []TrustedBlock{{Number: 9, Hash: otherHash}},
+			wantBreaks:  []string{ChainBreakTrusted},
+			wantTrusted: 1,
+		},
+		{
+			name:       "trusted block out of range",
+			trusted:    []TrustedBlock{{Number: 30, Hash: testBlockHash(30)}},
+			wantBreaks: []string{ChainBreakTrusted},
+		},
+		{
+			name: "parent hash",
+			modify: func(blocks []*BlockFull) []*BlockFull {
+				blocks[5].ParentHash = otherHash
+				return blocks
+			},
+			wantBreaks: []string{ChainBreakParentHash},
+		},
+		{
+			name: "gap",
+			modify: func(blocks []*BlockFull) []*BlockFull {
+				return slices.Delete(blocks, 4, 6)
+			},
+			wantBreaks: []string{ChainBreakGap},
+		},
+		{
+			name: "order",
+			modify: func(blocks []*BlockFull) []*BlockFull {
+				return slices.Insert(blocks, 6, blocks[3])
+			},
+			wantBreaks: []string{ChainBreakOrder, ChainBreakGap},
+		},
+		{
+			name: "block without number",
+			modify: func(blocks []*BlockFull) []*BlockFull {
+				return slices.Insert(blocks, 6, &BlockFull{})
+			},
+		},
+	}
+
+	for _, test := range tests {
+		checker, err := newChainChecker(test.trusted)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		blocks := testChain(10, 20)
+		if test.modify != nil {
+			blocks = test.modify(blocks)
+		}
+
+		for _, block := range blocks {
+			checker.add("blocks.json", block)
+		}
+
+		report := checker.finish()
+
+		kinds := make([]string, 0)
+		for _, chainBreak := range report.Breaks {
+			kinds = append(kinds, chainBreak.Kind)
+		}
+
+		if !slices.Equal(kinds, test.wantBreaks) {
+			t.Errorf("%s: breaks %v, want %v", test.name, report.Breaks, test.wantBreaks)
+		}
+
+		if report.TrustedBlocks != test.wantTrusted {
+			t.Errorf("%s: %d trusted blocks found, want %d", test.name, report.TrustedBlocks, test.wantTrusted)
+		}
+
+		if report.FromBlock != 10 || report.ToBlock != 20 {
+			t.Errorf("%s: report for blocks %d to %d, want 10 to 20", test.name, report.FromBlock, report.ToBlock)
+		}
+	}
+}
+
+func TestNewChainCheckerRejectsInvalidTrustedHashes(t *testing.T) {
+	for _, hash := range []string{"", "0x1234", strings.Repeat("ab", 32), "0x" + strings.Repeat("zz", 32)} {
+		if _, err := newChainChecker([]TrustedBlock{{Number: 1, Hash: hash}}); err == nil {
+			t.Errorf("trusted hash %q accepted, want an error", hash)
+		}
+	}
+}
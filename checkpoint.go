@@ -0,0 +1,519 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// BlockScanCheckpoint records the progress of a block scan. The blocks of the
+// first CompletedBatches batches are stored in Files, up to the recorded sizes.
+type BlockScanCheckpoint struct {
+	FromBlock          uint64             `json:"fromBlock"`
+	ToBlock            uint64             `json:"toBlock"`
+	BatchSize          uint64             `json:"batchSize"`
+	OutputFormat       string             `json:"outputFormat"`
+	Decoder            string             `json:"decoder"`
+	FilterAddresses    []string           `json:"filterAddresses"`
+	CompletedBatches   uint64             `json:"completedBatches"`
+	Files              []BlockFileEntry   `json:"files"`
+	TxCount            int                `json:"txCount"`
+	BlockCount         int                `json:"blockCount"`
+	WithdrawalCount    int                `json:"withdrawalCount"`
+	WithdrawalsBytes   int64              `json:"withdrawalsBytes"`
+	VerifyBlocks       bool               `json:"verifyBlocks"`
+	VerifyTransactions bool               `json:"verifyTransactions"`
+	Verification       VerificationReport `json:"verification"`
+	MissingBlocks      []uint64           `json:"missingBlocks"`
+	Failures           []FailedRequest    `json:"failures"`
+	UpdatedAt          int64              `json:"updatedAt"`
+}
+
+// matches reports whether the checkpoint was written by a scan with the same configuration.
+func (c *BlockScanCheckpoint) matches(config *Config) error {
+	blockScan := config.Scan.BlockScanConfig
+
+	if c.FromBlock != blockScan.FromBlock || c.ToBlock != blockScan.ToBlock || c.BatchSize != blockScan.BatchSize {
+		return fmt.Errorf("checkpoint is for blocks %d to %d in batches of %d, config has %d to %d in batches of %d",
+			c.FromBlock, c.ToBlock, c.BatchSize, blockScan.FromBlock, blockScan.ToBlock, blockScan.BatchSize)
+	}
+
+	if c.OutputFormat != blockScan.outputFormat() {
+		return fmt.Errorf("checkpoint was written with output format %q, config has %q", c.OutputFormat, blockScan.outputFormat())
+	}
+
+	if c.VerifyBlocks != blockScan.VerifyBlocks || c.VerifyTransactions != blockScan.VerifyTransactions {
+		return fmt.Errorf("checkpoint was written with verify_blocks = %t and verify_transactions = %t, config has %t and %t",
+			c.VerifyBlocks, c.VerifyTransactions, blockScan.VerifyBlocks, blockScan.VerifyTransactions)
+	}
+
+	if c.Decoder != config.Scan.decoder() {
+		return fmt.Errorf("checkpoint was written with decoder %q, config has %q", c.Decoder, config.Scan.decoder())
+	}
+
+	if !slices.Equal(c.FilterAddresses, config.Filter.Addresses) {
+		return fmt.Errorf("checkpoint was written with a different address filter")
+	}
+
+	return nil
+}
+
+// LoadBlockScanCheckpoint reads a block scan checkpoint from disk.
+func LoadBlockScanCheckpoint(path string) (*BlockScanCheckpoint, error) {
+	checkpoint := new(BlockScanCheckpoint)
+
+	if err := JSONToStruct(path, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint %s: %w", path, err)
+	}
+
+	return checkpoint, nil
+}
+
+// SaveCheckpoint atomically replaces the checkpoint at path, so that a crash
+// while writing never leaves a truncated checkpoint behind.
+func SaveCheckpoint(checkpoint any, path string) error {
+	tmpPath := path + ".tmp"
+
+	if err := SaveStructToJSONFile(checkpoint, tmpPath); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// JSONLWriter appends values as JSON lines through a buffered writer and
+// keeps track of the number of bytes written.
+type JSONLWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+	offset int64
+}
+
+// OpenJSONLWriter opens path for appending after truncating it to offset.
+// An offset of 0 starts a new file.
+func OpenJSONLWriter(path string, offset int64) (*JSONLWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	if info.Size() < offset {
+		file.Close()
+		return nil, fmt.Errorf("file %s has %d bytes, expected at least %d", path, info.Size(), offset)
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate file to %d bytes: %w", offset, err)
+	}
+
+	if _, err := file.Seek(offset, 0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek file: %w", err)
+	}
+
+	return &JSONLWriter{file: file, writer: bufio.NewWriter(file), offset: offset}, nil
+}
+
+// Write appends the value as a single JSON line.
+func (w *JSONLWriter) Write(value any) error {
+	line, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON line: %w", err)
+	}
+
+	line = append(line, '\n')
+
+	n, err := w.writer.Write(line)
+	w.offset += int64(n)
+
+	if err != nil {
+		return fmt.Errorf("failed to write JSON line: %w", err)
+	}
+
+	return nil
+}
+
+// Sync flushes the buffered lines to disk and returns the file size.
+func (w *JSONLWriter) Sync() (int64, error) {
+	if err := w.writer.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to flush file: %w", err)
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync file: %w", err)
+	}
+
+	return w.offset, nil
+}
+
+// Offset returns the number of bytes written, including buffered ones.
+func (w *JSONLWriter) Offset() int64 {
+	return w.offset
+}
+
+// Close flushes the buffered lines and closes the file.
+func (w *JSONLWriter) Close() error {
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to flush file: %w", err)
+	}
+
+	return w.file.Close()
+}
+
+// ReadJSONL decodes every line of a JSON lines file and passes it to fn.
+func ReadJSONL[T any](path string, fn func(value T) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+
+	for decoder.More() {
+		var value T
+		if err := decoder.Decode(&value); err != nil {
+			return fmt.Errorf("failed to decode JSON line from %s: %w", path, err)
+		}
+
+		if err := fn(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkpointInterval returns the configured number of batches between checkpoints, falling back to the default.
+func (b BlockScanConfig) checkpointInterval() uint64 {
+	if b.CheckpointInterval == 0 {
+		return DefaultCheckpointInterval
+	}
+
+	return b.CheckpointInterval
+}
+
+// newBlockScanCheckpoint creates the checkpoint of a fresh block scan.
+func newBlockScanCheckpoint(config *Config) *BlockScanCheckpoint {
+	return &BlockScanCheckpoint{
+		FromBlock:          config.Scan.BlockScanConfig.FromBlock,
+		ToBlock:            config.Scan.BlockScanConfig.ToBlock,
+		BatchSize:          config.Scan.BlockScanConfig.BatchSize,
+		OutputFormat:       config.Scan.BlockScanConfig.outputFormat(),
+		Decoder:            config.Scan.decoder(),
+		VerifyBlocks:       config.Scan.BlockScanConfig.VerifyBlocks,
+		VerifyTransactions: config.Scan.BlockScanConfig.VerifyTransactions,
+		Verification: VerificationReport{
+			FromBlock:             config.Scan.BlockScanConfig.FromBlock,
+			ToBlock:               config.Scan.BlockScanConfig.ToBlock,
+			BlockMismatches:       make([]BlockMismatch, 0),
+			TransactionMismatches: make([]TransactionMismatch, 0),
+		},
+		FilterAddresses: config.Filter.Addresses,
+		Files:           make([]BlockFileEntry, 0),
+		MissingBlocks:   make([]uint64, 0),
+		Failures:        make([]FailedRequest, 0),
+		UpdatedAt:       time.Now().Unix(),
+	}
+}
+
+// AccountPartitionCheckpoint records the progress of one key range of an
+// account scan. The accounts of the scanned pages are stored in File, up to
+// OutputBytes, and the range continues from NextKey until EndKey.
+type AccountPartitionCheckpoint struct {
+	StartKey        string `json:"startKey"`
+	EndKey          string `json:"endKey"`
+	NextKey         string `json:"nextKey"`
+	LastKey         string `json:"lastKey"` // Key of the last account handled, accounts up to it are skipped
+	Done            bool   `json:"done"`
+	File            string `json:"file"`
+	OutputBytes     int64  `json:"outputBytes"`
+	Pages           uint64 `json:"pages"`
+	ScannedAccounts uint64 `json:"scannedAccounts"`
+	WrittenAccounts uint64 `json:"writtenAccounts"`
+	Contracts       uint64 `json:"contracts"`
+	NonContracts    uint64 `json:"nonContracts"`
+}
+
+// AccountScanCheckpoint records the progress of an account scan after every page.
+type AccountScanCheckpoint struct {
+	BlockNumber     uint64                       `json:"blockNumber"`
+	StartKey        string                       `json:"startKey"`
+	EndKey          string                       `json:"endKey"`
+	Filter          AccountFilterConfig          `json:"filter"`
+	FilterAddresses []string                     `json:"filterAddresses"`
+	Partitions      []AccountPartitionCheckpoint `json:"partitions"`
+	UpdatedAt       int64                        `json:"updatedAt"`
+}
+
+// matches reports whether the checkpoint was written by a scan with the same configuration.
+func (c *AccountScanCheckpoint) matches(config *Config) error {
+	accountScan := config.Scan.AccountScanConfig
+
+	if c.BlockNumber != accountScan.BlockNumber || c.StartKey != accountScan.StartKey || c.EndKey != accountScan.EndKey {
+		return fmt.Errorf("checkpoint is for block %d from key %q to %q, config has block %d from key %q to %q",
+			c.BlockNumber, c.StartKey, c.EndKey, accountScan.BlockNumber, accountScan.StartKey, accountScan.EndKey)
+	}
+
+	if len(c.Partitions) != accountScan.partitionCount() {
+		return fmt.Errorf("checkpoint has %d partitions, config has %d", len(c.Partitions), accountScan.partitionCount())
+	}
+
+	filter := accountScan.Filter
+	sameFilter := c.Filter.Mode == filter.Mode && c.Filter.MinBalance == filter.MinBalance && c.Filter.MaxBalance == filter.MaxBalance &&
+		c.Filter.MinNonce == filter.MinNonce && c.Filter.MaxNonce == filter.MaxNonce &&
+		slices.Equal(c.Filter.CodeHashes, filter.CodeHashes) && slices.Equal(c.Filter.ExcludeCodeHashes, filter.ExcludeCodeHashes)
+
+	if !sameFilter || !slices.Equal(c.FilterAddresses, config.Filter.Addresses) {
+		return fmt.Errorf("checkpoint was written with a different account filter")
+	}
+
+	return nil
+}
+
+// totals sums the progress of all partitions.
+func (c *AccountScanCheckpoint) totals() AccountPartitionCheckpoint {
+	var totals AccountPartitionCheckpoint
+
+	for _, partition := range c.Partitions {
+		totals.OutputBytes += partition.OutputBytes
+		totals.Pages += partition.Pages
+		totals.ScannedAccounts += partition.ScannedAccounts
+		totals.WrittenAccounts += partition.WrittenAccounts
+		totals.Contracts += partition.Contracts
+		totals.NonContracts += partition.NonContracts
+	}
+
+	return totals
+}
+
+// LoadAccountScanCheckpoint reads an account scan checkpoint from disk.
+func LoadAccountScanCheckpoint(path string) (*AccountScanCheckpoint, error) {
+	checkpoint := new(AccountScanCheckpoint)
+
+	if err := JSONToStruct(path, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint %s: %w", path, err)
+	}
+
+	return checkpoint, nil
+}
+
+// newAccountScanCheckpoint creates the checkpoint of a fresh account scan,
+// with the key space split into the configured number of partitions.
+func newAccountScanCheckpoint(config *Config, baseName string) (*AccountScanCheckpoint, error) {
+	accountScan := config.Scan.AccountScanConfig
+
+	partitions, err := partitionAccountKeySpace(accountScan.StartKey, accountScan.EndKey, accountScan.partitionCount())
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range partitions {
+		partitions[i].File = fmt.Sprintf("%s.part%03d.jsonl", baseName, i+1)
+	}
+
+	return &AccountScanCheckpoint{
+		BlockNumber:     accountScan.BlockNumber,
+		StartKey:        accountScan.StartKey,
+		EndKey:          accountScan.EndKey,
+		Filter:          accountScan.Filter,
+		FilterAddresses: config.Filter.Addresses,
+		Partitions:      partitions,
+		UpdatedAt:       time.Now().Unix(),
+	}, nil
+}
+
+// LogScanCheckpoint records the progress of a log scan. The logs of the first
+// CompletedRanges block ranges are stored in the output, up to OutputBytes.
+type LogScanCheckpoint struct {
+	FromBlock       uint64          `json:"fromBlock"`
+	ToBlock         uint64          `json:"toBlock"`
+	BlockRange      uint64          `json:"blockRange"`
+	Addresses       []string        `json:"addresses"`
+	Topics          [][]string      `json:"topics"`
+	CompletedRanges uint64          `json:"completedRanges"`
+	OutputBytes     int64           `json:"outputBytes"`
+	LogCount        uint64          `json:"logCount"`
+	Requests        uint64          `json:"requests"`
+	Splits          uint64          `json:"splits"`
+	Failures        []FailedRequest `json:"failures"`
+	UpdatedAt       int64           `json:"updatedAt"`
+}
+
+// matches reports whether the checkpoint was written by a scan with the same configuration.
+func (c *LogScanCheckpoint) matches(config *Config) error {
+	logScan := config.Scan.LogScanConfig
+
+	if c.FromBlock != config.Scan.FromBlock || c.ToBlock != config.Scan.ToBlock || c.BlockRange != logScan.blockRange() {
+		return fmt.Errorf("checkpoint is for blocks %d to %d in ranges of %d, config has %d to %d in ranges of %d",
+			c.FromBlock, c.ToBlock, c.BlockRange, config.Scan.FromBlock, config.Scan.ToBlock, logScan.blockRange())
+	}
+
+	if !slices.Equal(c.Addresses, logScan.Addresses) || !slices.EqualFunc(c.Topics, logScan.Topics, slices.Equal) {
+		return fmt.Errorf("checkpoint was written with a different log filter")
+	}
+
+	return nil
+}
+
+// LoadLogScanCheckpoint reads a log scan checkpoint from disk.
+func LoadLogScanCheckpoint(path string) (*LogScanCheckpoint, error) {
+	checkpoint := new(LogScanCheckpoint)
+
+	if err := JSONToStruct(path, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint %s: %w", path, err)
+	}
+
+	return checkpoint, nil
+}
+
+// newLogScanCheckpoint creates the checkpoint of a fresh log scan.
+func newLogScanCheckpoint(config *Config) *LogScanCheckpoint {
+	return &LogScanCheckpoint{
+		FromBlock:  config.Scan.FromBlock,
+		ToBlock:    config.Scan.ToBlock,
+		BlockRange: config.Scan.LogScanConfig.blockRange(),
+		Addresses:  config.Scan.LogScanConfig.Addresses,
+		Topics:     config.Scan.LogScanConfig.Topics,
+		Failures:   make([]FailedRequest, 0),
+		UpdatedAt:  time.Now().Unix(),
+	}
+}
+
+// TraceScanCheckpoint records the progress of a trace scan. The internal
+// transactions of the first CompletedBatches batches are stored in the output,
+// up to OutputBytes.
+type TraceScanCheckpoint struct {
+	FromBlock        uint64          `json:"fromBlock"`
+	ToBlock          uint64          `json:"toBlock"`
+	BatchSize        uint64          `json:"batchSize"`
+	FilterAddresses  []string        `json:"filterAddresses"`
+	CompletedBatches uint64          `json:"completedBatches"`
+	OutputBytes      int64           `json:"outputBytes"`
+	BlockCount       uint64          `json:"blockCount"`
+	TxCount          uint64          `json:"txCount"`
+	CallCount        uint64          `json:"callCount"`
+	Failures         []FailedRequest `json:"failures"`
+	UpdatedAt        int64           `json:"updatedAt"`
+}
+
+// matches reports whether the checkpoint was written by a scan with the same configuration.
+func (c *TraceScanCheckpoint) matches(config *Config) error {
+	traceScan := config.Scan.TraceScanConfig
+
+	if c.FromBlock != config.Scan.FromBlock || c.ToBlock != config.Scan.ToBlock || c.BatchSize != traceScan.BatchSize {
+		return fmt.Errorf("checkpoint is for blocks %d to %d in batches of %d, config has %d to %d in batches of %d",
+			c.FromBlock, c.ToBlock, c.BatchSize, config.Scan.FromBlock, config.Scan.ToBlock, traceScan.BatchSize)
+	}
+
+	if !slices.Equal(c.FilterAddresses, config.Filter.Addresses) {
+		return fmt.Errorf("checkpoint was written with a different address filter")
+	}
+
+	return nil
+}
+
+// LoadTraceScanCheckpoint reads a trace scan checkpoint from disk.
+func LoadTraceScanCheckpoint(path string) (*TraceScanCheckpoint, error) {
+	checkpoint := new(TraceScanCheckpoint)
+
+	if err := JSONToStruct(path, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint %s: %w", path, err)
+	}
+
+	return checkpoint, nil
+}
+
+// newTraceScanCheckpoint creates the checkpoint of a fresh trace scan.
+func newTraceScanCheckpoint(config *Config) *TraceScanCheckpoint {
+	return &TraceScanCheckpoint{
+		FromBlock:       config.Scan.FromBlock,
+		ToBlock:         config.Scan.ToBlock,
+		BatchSize:       config.Scan.TraceScanConfig.BatchSize,
+		FilterAddresses: config.Filter.Addresses,
+		Failures:        make([]FailedRequest, 0),
+		UpdatedAt:       time.Now().Unix(),
+	}
+}
+
+// ReceiptScanCheckpoint records the progress of a receipt scan. The receipts
+// of the first CompletedBatches batches are stored in the partial output, up
+// to OutputBytes.
+type ReceiptScanCheckpoint struct {
+	FromBlock        uint64          `json:"fromBlock"`
+	ToBlock          uint64          `json:"toBlock"`
+	BlockFile        string          `json:"blockFile"` // Empty when the block range of the configuration is scanned
+	BatchSize        uint64          `json:"batchSize"`
+	Decoder          string          `json:"decoder"`
+	CompletedBatches uint64          `json:"completedBatches"`
+	OutputBytes      int64           `json:"outputBytes"`
+	BlockCount       uint64          `json:"blockCount"`
+	ReceiptCount     uint64          `json:"receiptCount"`
+	Failures         []FailedRequest `json:"failures"`
+	UpdatedAt        int64           `json:"updatedAt"`
+}
+
+// matches reports whether the checkpoint was written by a scan of the same blocks with the same configuration.
+func (c *ReceiptScanCheckpoint) matches(config *Config, blockFile string) error {
+	batchSize := config.Scan.ReceiptScanConfig.batchSize()
+
+	if c.FromBlock != config.Scan.FromBlock || c.ToBlock != config.Scan.ToBlock || c.BatchSize != batchSize {
+		return fmt.Errorf("checkpoint is for blocks %d to %d in batches of %d, config has %d to %d in batches of %d",
+			c.FromBlock, c.ToBlock, c.BatchSize, config.Scan.FromBlock, config.Scan.ToBlock, batchSize)
+	}
+
+	if c.BlockFile != blockFile {
+		return fmt.Errorf("checkpoint was written for block file %q, got %q", c.BlockFile, blockFile)
+	}
+
+	if c.Decoder != config.Scan.decoder() {
+		return fmt.Errorf("checkpoint was written with decoder %q, config has %q", c.Decoder, config.Scan.decoder())
+	}
+
+	return nil
+}
+
+// LoadReceiptScanCheckpoint reads a receipt scan checkpoint from disk.
+func LoadReceiptScanCheckpoint(path string) (*ReceiptScanCheckpoint, error) {
+	checkpoint := new(ReceiptScanCheckpoint)
+
+	if err := JSONToStruct(path, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint %s: %w", path, err)
+	}
+
+	return checkpoint, nil
+}
+
+// newReceiptScanCheckpoint creates the checkpoint of a fresh receipt scan.
+func newReceiptScanCheckpoint(config *Config, blockFile string) *ReceiptScanCheckpoint {
+	return &ReceiptScanCheckpoint{
+		FromBlock: config.Scan.FromBlock,
+		ToBlock:   config.Scan.ToBlock,
+		BlockFile: blockFile,
+		BatchSize: config.Scan.ReceiptScanConfig.batchSize(),
+		Decoder:   config.Scan.decoder(),
+		Failures:  make([]FailedRequest, 0),
+		UpdatedAt: time.Now().Unix(),
+	}
+}
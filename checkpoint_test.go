@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBlockScanCheckpointMatches(t *testing.T) {
+	newConfig := func() *Config {
+		config := new(Config)
+		config.Scan.BlockScanConfig = BlockScanConfig{FromBlock: 100, ToBlock: 200, BatchSize: 10}
+		config.Filter.Addresses = []string{"0x" + strings.Repeat("11", 20)}
+		return config
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(config *Config)
+		wantErr bool
+	}{
+		{name: "same configuration", modify: func(config *Config) {}},
+		{name: "other output directory", modify: func(config *Config) { config.Scan.OutputDir = "other" }},
+		{name: "other first block", modify: func(config *Config) { config.Scan.BlockScanConfig.FromBlock = 101 }, wantErr: true},
+		{name: "other last block", modify: func(config *Config) { config.Scan.BlockScanConfig.ToBlock = 300 }, wantErr: true},
+		{name: "other batch size", modify: func(config *Config) { config.Scan.BlockScanConfig.BatchSize = 20 }, wantErr: true},
+		{name: "no filter", modify: func(config *Config) { config.Filter.Addresses = nil }, wantErr: true},
+		{
+			name:    "other filter",
+			modify:  func(config *Config) { config.Filter.Addresses = []string{"0x" + strings.Repeat("22", 20)} },
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		checkpoint := newBlockScanCheckpoint(newConfig())
+
+		config := newConfig()
+		test.modify(config)
+
+		err := checkpoint.matches(config)
+
+		if test.wantErr && err == nil {
+			t.Errorf("%s: checkpoint matches, want an error", test.name)
+		}
+
+		if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestReceiptScanCheckpointMatches(t *testing.T) {
+	const blockFile = "output/blocks_100_to_200.jsonl"
+
+	newConfig := func() *Config {
+		config := new(Config)
+		config.Scan.BlockScanConfig = BlockScanConfig{FromBlock: 100, ToBlock: 200}
+		config.Scan.ReceiptScanConfig = ReceiptScanConfig{BatchSize: 10}
+		return config
+	}
+
+	tests := []struct {
+		name      string
+		modify    func(config *Config)
+		blockFile string
+		wantErr   bool
+	}{
+		{name: "same configuration", modify: func(config *Config) {}, blockFile: blockFile},
+		{name: "other first block", modify: func(config *Config) { config.Scan.BlockScanConfig.FromBlock = 101 }, blockFile: blockFile, wantErr: true},
+		{name: "other batch size", modify: func(config *Config) { config.Scan.ReceiptScanConfig.BatchSize = 20 }, blockFile: blockFile, wantErr: true},
+		{name: "other decoder", modify: func(config *Config) { config.Scan.Decoder = DecoderNative }, blockFile: blockFile, wantErr: true},
+		{name: "block range of the configuration", modify: func(config *Config) {}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		checkpoint := newReceiptScanCheckpoint(newConfig(), blockFile)
+
+		config := newConfig()
+		test.modify(config)
+
+		err := checkpoint.matches(config, test.blockFile)
+
+		if test.wantErr && err == nil {
+			t.Errorf("%s: checkpoint matches, want an error", test.name)
+		}
+
+		if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestOpenJSONLWriterTruncates(t *testing.T) {
+	// Two complete lines followed by a line left over by an interrupted scan.
+	const existing = "{\"n\":1}\n{\"n\":2}\n{\"n\":3"
+
+	tests := []struct {
+		name    string
+		create  bool
+		offset  int64
+		want    string
+		wantErr bool
+	}{
+		{name: "new file", want: "{\"n\":4}\n"},
+		{name: "restart", create: true, offset: 0, want: "{\"n\":4}\n"},
+		{name: "resume", create: true, offset: 16, want: "{\"n\":1}\n{\"n\":2}\n{\"n\":4}\n"},
+		{name: "resume at end", create: true, offset: int64(len(existing)), want: existing + "{\"n\":4}\n"},
+		{name: "file shorter than checkpoint", create: true, offset: int64(len(existing)) + 1, wantErr: true},
+		{name: "missing file", offset: 16, wantErr: true},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "blocks.jsonl")
+
+		if test.create {
+			if err := os.WriteFile(path, []byte(existing), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		writer, err := OpenJSONLWriter(path, test.offset)
+
+		if test.wantErr {
+			if err == nil {
+				writer.Close()
+				t.Errorf("%s: writer opened, want an error", test.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if err := writer.Write(map[string]int{"n": 4}); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		offset, err := writer.Sync()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if err := writer.Close(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(content) != test.want {
+			t.Errorf("%s: content %q, want %q", test.name, content, test.want)
+		}
+
+		if offset != int64(len(content)) {
+			t.Errorf("%s: offset %d, want the file size %d", test.name, offset, len(content))
+		}
+	}
+}
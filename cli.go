@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -58,6 +59,11 @@ func GetCobraRootCmd() *cobra.Command {
 		},
 	}
 
+	// ------------------------------------------------------
+	// scan-blocks command
+	// ------------------------------------------------------
+	var resume bool
+
 	scanBlocksCmd := &cobra.Command{
 		Use:   "scan-blocks",
 		Short: "Scan blocks",
@@ -71,9 +77,9 @@ func GetCobraRootCmd() *cobra.Command {
 				cmd.Println("Error loading config:", err)
 				return
 			}
-			if err := ScanBlocksWithConfig(config); err != nil {
+			if err := ScanBlocksWithConfig(config, resume); err != nil {
 				cmd.Println("Error scanning full blocks:", err)
-				return
+				os.Exit(1)
 			}
 			cmd.Println("Blocks scanned successfully.")
 		},
@@ -92,8 +98,29 @@ func GetCobraRootCmd() *cobra.Command {
 				cmd.Println("Error: config file path is required (use --config).")
 				return
 			}
-			if blockFile == "" {
-				cmd.Println("Error: block file path is required (use --block-file).")
+			config, err := GetConfig(configFile)
+			if err != nil {
+				cmd.Println("Error loading config:", err)
+				return
+			}
+
+			if err := ScanReceiptsWithConfig(config, blockFile, resume); err != nil {
+				cmd.Println("Error scanning receipts:", err)
+				os.Exit(1)
+			}
+			cmd.Println("Receipts scanned successfully.")
+		},
+	}
+
+	// ------------------------------------------------------
+	// scan-logs command
+	// ------------------------------------------------------
+	scanLogsCmd := &cobra.Command{
+		Use:   "scan-logs",
+		Short: "Scan event logs with eth_getLogs",
+		Run: func(cmd *cobra.Command, args []string) {
+			if configFile == "" {
+				cmd.Println("Error: config file path is required (use --config).")
 				return
 			}
 			config, err := GetConfig(configFile)
@@ -101,12 +128,35 @@ func GetCobraRootCmd() *cobra.Command {
 				cmd.Println("Error loading config:", err)
 				return
 			}
+			if err := ScanLogsWithConfig(config, resume); err != nil {
+				cmd.Println("Error scanning logs:", err)
+				os.Exit(1)
+			}
+			cmd.Println("Logs scanned successfully.")
+		},
+	}
 
-			if err := ScanReceiptsWithConfig(config, blockFile); err != nil {
-				cmd.Println("Error scanning receipts:", err)
+	// ------------------------------------------------------
+	// scan-traces command
+	// ------------------------------------------------------
+	scanTracesCmd := &cobra.Command{
+		Use:   "scan-traces",
+		Short: "Scan internal transactions with debug_traceBlockByHash",
+		Run: func(cmd *cobra.Command, args []string) {
+			if configFile == "" {
+				cmd.Println("Error: config file path is required (use --config).")
 				return
 			}
-			cmd.Println("Receipts scanned successfully.")
+			config, err := GetConfig(configFile)
+			if err != nil {
+				cmd.Println("Error loading config:", err)
+				return
+			}
+			if err := ScanTracesWithConfig(config, resume); err != nil {
+				cmd.Println("Error scanning traces:", err)
+				os.Exit(1)
+			}
+			cmd.Println("Traces scanned successfully.")
 		},
 	}
 
@@ -125,9 +175,9 @@ func GetCobraRootCmd() *cobra.Command {
 				return
 			}
 
-			if err := ScanAllAccounts(config); err != nil {
+			if err := ScanAllAccounts(config, resume); err != nil {
 				cmd.Println("Error scanning accounts:", err)
-				return
+				os.Exit(1)
 			}
 
 			cmd.Println("Accounts scanned successfully.")
@@ -158,23 +208,97 @@ func GetCobraRootCmd() *cobra.Command {
 
 			if err := ScanContractCode(config, accountsFile); err != nil {
 				cmd.Println("Error scanning contract code:", err)
-				return
+				os.Exit(1)
 			}
 
 			cmd.Println("Contract code scanned successfully.")
 		},
 	}
 
+	// ------------------------------------------------------
+	// verify command
+	// ------------------------------------------------------
+	var receiptsFile string
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the block hashes, transactions roots and receipts roots of scanned blocks",
+		Run: func(cmd *cobra.Command, args []string) {
+			if configFile == "" {
+				cmd.Println("Error: config file path is required (use --config).")
+				return
+			}
+			if blockFile == "" {
+				cmd.Println("Error: block file path is required (use --block-file).")
+				return
+			}
+			config, err := GetConfig(configFile)
+			if err != nil {
+				cmd.Println("Error loading config:", err)
+				return
+			}
+
+			if err := VerifyBlocksWithConfig(config, blockFile, receiptsFile); err != nil {
+				cmd.Println("Verification failed:", err)
+				os.Exit(1)
+			}
+			cmd.Println("Blocks verified successfully.")
+		},
+	}
+
+	// ------------------------------------------------------
+	// check-chain command
+	// ------------------------------------------------------
+	var blockFiles []string
+
+	checkChainCmd := &cobra.Command{
+		Use:   "check-chain",
+		Short: "Check that scanned blocks form a single chain, across one or more block files",
+		Run: func(cmd *cobra.Command, args []string) {
+			if configFile == "" {
+				cmd.Println("Error: config file path is required (use --config).")
+				return
+			}
+			if len(blockFiles) == 0 {
+				cmd.Println("Error: at least one block file is required (use --block-file).")
+				return
+			}
+			config, err := GetConfig(configFile)
+			if err != nil {
+				cmd.Println("Error loading config:", err)
+				return
+			}
+
+			if err := CheckChainWithConfig(config, blockFiles); err != nil {
+				cmd.Println("Chain check failed:", err)
+				os.Exit(1)
+			}
+			cmd.Println("Chain checked successfully.")
+		},
+	}
+
 	// ----------------------------------------
 	// Flags for all commands
 	// ----------------------------------------
 	testConnectionCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to the config file")
 	scanBlocksCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to the config file")
+	scanBlocksCmd.Flags().BoolVarP(&resume, "resume", "r", false, "Resume from the last checkpoint")
 	scanReceiptsCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to the config file")
-	scanReceiptsCmd.Flags().StringVarP(&blockFile, "block-file", "b", "", "Path to the block file")
+	scanReceiptsCmd.Flags().StringVarP(&blockFile, "block-file", "b", "", "Path to the block file or block manifest (default: the block range of the config)")
+	scanReceiptsCmd.Flags().BoolVarP(&resume, "resume", "r", false, "Resume from the last checkpoint")
+	scanLogsCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to the config file")
+	scanLogsCmd.Flags().BoolVarP(&resume, "resume", "r", false, "Resume from the last checkpoint")
+	scanTracesCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to the config file")
+	scanTracesCmd.Flags().BoolVarP(&resume, "resume", "r", false, "Resume from the last checkpoint")
 	scanAccountsCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to the config file")
+	scanAccountsCmd.Flags().BoolVarP(&resume, "resume", "r", false, "Resume from the last checkpoint")
 	scanContractCodeCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to the config file")
 	scanContractCodeCmd.Flags().StringVarP(&accountsFile, "accounts-file", "a", "", "Path to the accounts file")
+	verifyCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to the config file")
+	verifyCmd.Flags().StringVarP(&blockFile, "block-file", "b", "", "Path to the block file or block manifest")
+	verifyCmd.Flags().StringVarP(&receiptsFile, "receipts-file", "t", "", "Path to the receipts file (optional, enables the receipts root check)")
+	checkChainCmd.Flags().StringVarP(&configFile, "config", "c", "", "Path to the config file")
+	checkChainCmd.Flags().StringSliceVarP(&blockFiles, "block-file", "b", nil, "Path to a block file or block manifest, repeated in block order")
 
 	// ----------------------------------------
 	// Add commands to root command
@@ -183,8 +307,12 @@ func GetCobraRootCmd() *cobra.Command {
 	rootCmd.AddCommand(testConnectionCmd)
 	rootCmd.AddCommand(scanBlocksCmd)
 	rootCmd.AddCommand(scanReceiptsCmd)
+	rootCmd.AddCommand(scanLogsCmd)
+	rootCmd.AddCommand(scanTracesCmd)
 	rootCmd.AddCommand(scanAccountsCmd)
 	rootCmd.AddCommand(scanContractCodeCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(checkChainCmd)
 
 	return rootCmd
 }
@@ -12,62 +12,172 @@ const (
 
 	// Default values for the RPC configuration
 	DefaultRpcUrl    = "ws://localhost:8546" // Default URL for the RPC server
-	DefaultRpcDelay  = 1000                  // Default delay between requests in milliseconds
 	DefaultBatchSize = 1                     // Default batch size for requests
+	DefaultWorkers   = 1                     // Default number of concurrent workers
+
+	DefaultRequestTimeout = 60000 // Default timeout for a single request in milliseconds
+
+	// Default values for the rate limiter
+	DefaultRequestsPerSecond     = 1    // Default number of requests per second
+	DefaultRateLimitMinFactor    = 0.05 // Default lowest fraction of the configured rates when throttled
+	DefaultRateLimitRecoveryStep = 0.01 // Default fraction of the configured rates regained per successful request
+
+	// Default values for the RPC endpoint pool
+	DefaultPoolStrategy        = StrategyRoundRobin // Default endpoint selection strategy
+	DefaultHealthCheckInterval = 30000              // Default interval between health checks in milliseconds
+	DefaultMaxBlockLag         = 10                 // Default number of blocks an endpoint may lag behind the head
+
+	// Default values for the retry policy
+	DefaultRetryMaxAttempts    = 5     // Default number of attempts per request (including the first one)
+	DefaultRetryInitialBackoff = 500   // Default backoff before the first retry in milliseconds
+	DefaultRetryMaxBackoff     = 30000 // Default upper bound for the backoff in milliseconds
+	DefaultRetryJitter         = 0.2   // Default random jitter applied to each backoff (0..1)
 
 	// Default values for the scanning configuration
-	DefaultFromBlock = 1
-	DefaultToBlock   = 100
+	DefaultFromBlock  = 1
+	DefaultToBlock    = 100
+	DefaultGapRetries = 3 // Default number of rounds re-fetching missing blocks
+
+	DefaultCheckpointInterval = 10     // Default number of batches between checkpoints
+	DefaultRotateBlocks       = 100000 // Default number of blocks per JSON lines file
+
+	DefaultAccountScanBlockNumber = 48_000_000            // Default block number for account scanning
+	DefaultAccountPartitions      = 1                     // Default number of key ranges scanned in parallel
+	DefaultAccountFilterMode      = AccountFilterContract // Default kind of accounts kept by the account scan
+	DefaultAccountMinBalance      = "1"                   // Default minimum balance (wei) of the kept accounts
 
-	DefaultAccountScanBlockNumber = 48_000_000 // Default block number for account scanning
+	DefaultReceiptMethod    = ReceiptMethodAuto // Default way of fetching receipts
+	DefaultReceiptBatchSize = 10                // Default number of blocks per receipt batch
+
+	DefaultLogBlockRange = 2000 // Default number of blocks per eth_getLogs request (split on "too many results")
 
 	DefaultOutputDir = "output"
+	DefaultDecoder   = DecoderRpc // Default decoder for block and receipt responses
 )
 
 var DefaultFilterAddresses = []string{}
 
+type RetryConfig struct {
+	MaxAttempts    uint64  `toml:"max_attempts"`    // Maximum number of attempts per request (including the first one)
+	InitialBackoff uint64  `toml:"initial_backoff"` // Backoff before the first retry in milliseconds
+	MaxBackoff     uint64  `toml:"max_backoff"`     // Upper bound for the exponential backoff in milliseconds
+	Jitter         float64 `toml:"jitter"`          // Random jitter applied to each backoff (0..1)
+}
+
+type EndpointConfig struct {
+	Url    string `toml:"url"`    // URL for the RPC server
+	Weight uint64 `toml:"weight"` // Relative share of the requests for round-robin selection
+}
+
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `toml:"requests_per_second"` // Requests per second (0 = unlimited)
+	ElementsPerSecond float64 `toml:"elements_per_second"` // Batch elements per second (0 = unlimited)
+	MinFactor         float64 `toml:"min_factor"`          // Lowest fraction of the configured rates when the provider throttles
+	RecoveryStep      float64 `toml:"recovery_step"`       // Fraction of the configured rates regained per successful request
+}
+
 type RpcConfig struct {
-	Url   string `toml:"url"`   // URL for the RPC server
-	Delay uint64 `toml:"delay"` // Delay between requests in milliseconds
+	Url                 string           `toml:"url"`                   // URL for the RPC server (used when no endpoints are listed)
+	Endpoints           []EndpointConfig `toml:"endpoints"`             // RPC servers of the endpoint pool
+	Strategy            string           `toml:"strategy"`              // Endpoint selection strategy: "round_robin" or "least_latency"
+	HealthCheckInterval uint64           `toml:"health_check_interval"` // Interval between endpoint health checks in milliseconds
+	MaxBlockLag         uint64           `toml:"max_block_lag"`         // Blocks an endpoint may lag behind the highest head before failover (0 disables)
+	Delay               uint64           `toml:"delay,omitzero"`        // Deprecated: use rate_limit.requests_per_second instead
+	Workers             uint64           `toml:"workers"`               // Number of concurrent workers fetching batches
+	Timeout             uint64           `toml:"timeout"`               // Timeout for a single request in milliseconds
+	RateLimit           RateLimitConfig  `toml:"rate_limit"`            // Rate limits shared by all workers
+	Retry               RetryConfig      `toml:"retry"`                 // Retry policy for failed requests
 }
 
 type BlockScanConfig struct {
-	FromBlock      uint64 `toml:"from_block"`       // Starting block for scanning
-	ToBlock        uint64 `toml:"to_block"`         // Ending block for scanning
-	OutputFileName string `toml:"output_file_name"` // File name for saving the scanned blocks
-	BatchSize      uint64 `toml:"batch_size"`       // Batch size for requests
+	FromBlock          uint64         `toml:"from_block"`          // Starting block for scanning
+	ToBlock            uint64         `toml:"to_block"`            // Ending block for scanning
+	OutputFileName     string         `toml:"output_file_name"`    // File name for saving the scanned blocks
+	BatchSize          uint64         `toml:"batch_size"`          // Maximum batch size for requests (shrunk adaptively on errors)
+	GapRetries         uint64         `toml:"gap_retries"`         // Rounds re-fetching blocks missing from a batch
+	CheckpointInterval uint64         `toml:"checkpoint_interval"` // Batches between checkpoints of the partial output
+	OutputFormat       string         `toml:"output_format"`       // "json" for a single JSON array or "jsonl" for rotated JSON lines files
+	RotateBlocks       uint64         `toml:"rotate_blocks"`       // Blocks per JSON lines file (0 = no limit)
+	RotateBytes        uint64         `toml:"rotate_bytes"`        // Bytes per JSON lines file (0 = no limit)
+	VerifyBlocks       bool           `toml:"verify_blocks"`       // Recompute the hash and transactions root of every block
+	VerifyTransactions bool           `toml:"verify_transactions"` // Recompute the hash and recover the sender of every saved transaction
+	CheckChain         bool           `toml:"check_chain"`         // Check after the scan that every parent hash is the hash of the previous block
+	TrustedBlocks      []TrustedBlock `toml:"trusted_blocks"`      // Blocks of known hash the chain must contain (a block before the range is checked through its child)
+
+}
 
+// TrustedBlock is a block hash obtained from a trusted source, used to anchor the chain check.
+type TrustedBlock struct {
+	Number uint64 `toml:"number"` // Block number
+	Hash   string `toml:"hash"`   // Block hash
 }
 
 type AccountScanConfig struct {
-	BlockNumber    uint64 `toml:"block_number"`     // The state block number to scan
-	MaxAccounts    uint64 `toml:"max_accounts"`     // Maximum number of accounts to scan
-	StartKey       string `toml:"start_key"`        // Starting key for scanning (used for pagination)
-	OutputFileName string `toml:"output_file_name"` // File name for saving the scanned accounts
-	BatchSize      uint64 `toml:"batch_size"`       // Batch size for requests
+	BlockNumber    uint64              `toml:"block_number"`     // The state block number to scan
+	MaxAccounts    uint64              `toml:"max_accounts"`     // Maximum number of accounts to scan
+	StartKey       string              `toml:"start_key"`        // Starting key for scanning (used for pagination)
+	EndKey         string              `toml:"end_key"`          // Key at which the scan stops, exclusive (empty = end of the key space)
+	OutputFileName string              `toml:"output_file_name"` // File name for saving the scanned accounts
+	BatchSize      uint64              `toml:"batch_size"`       // Batch size for requests
+	Partitions     uint64              `toml:"partitions"`       // Number of disjoint key ranges scanned in parallel
+	Filter         AccountFilterConfig `toml:"filter"`           // Which of the scanned accounts are saved
+}
+
+// AccountFilterConfig selects the accounts saved by the account scan. Without
+// a mode, only contracts with a non-zero balance are kept. Accounts are scanned
+// without their code, so EOAs with an EIP-7702 delegation count as contracts:
+// the contract code scan tells them apart.
+type AccountFilterConfig struct {
+	Mode              string   `toml:"mode"`                // Accounts to keep: "all", "eoa" or "contract"
+	MinBalance        string   `toml:"min_balance"`         // Minimum balance in wei, inclusive (empty = no limit)
+	MaxBalance        string   `toml:"max_balance"`         // Maximum balance in wei, inclusive (empty = no limit)
+	MinNonce          uint64   `toml:"min_nonce"`           // Minimum nonce, inclusive
+	MaxNonce          uint64   `toml:"max_nonce"`           // Maximum nonce, inclusive (0 = no limit)
+	CodeHashes        []string `toml:"code_hashes"`         // Only keep accounts with one of these code hashes (empty = all)
+	ExcludeCodeHashes []string `toml:"exclude_code_hashes"` // Skip accounts with one of these code hashes
 }
 
 type ContractCodeScanConfig struct {
 	OutputFileName string `toml:"output_file_name"` // File name for saving the scanned contract codes
-	BatchSize      uint64 `toml:"batch_size"`       // Batch size for requests
+	BatchSize      uint64 `toml:"batch_size"`       // Maximum batch size for requests (shrunk adaptively on errors)
 }
 
 type ReceiptScanConfig struct {
-	// TODO: For now, this only accepts the exported BlockScan data,
-	// but it should be able to accept any array of transaction hashes
+	// TODO: This accepts the exported BlockScan data or the block range of the
+	// block scan, but it should be able to accept any array of transaction hashes
 	FullBlocksFile string `toml:"full_blocks_file"` // File containing full blocks for scanning
 	// TODO: TransactionHashesFile string `toml:"transaction_hashes_file"` // List of transaction hashes to scan
 	OutputFileName string `toml:"output_file_name"` // File name for saving the scanned receipts
-	BatchSize      uint64 `toml:"batch_size"`       // Batch size for requests
+	BatchSize      uint64 `toml:"batch_size"`       // Number of blocks per batch, whatever the method (requests are still split adaptively on errors)
+	Method         string `toml:"method"`           // "auto", "block" (eth_getBlockReceipts) or "transaction" (eth_getTransactionReceipt)
 
 }
 
+// LogScanConfig selects the logs fetched with eth_getLogs over the block range
+// of the block scan. Each topic position matches any of its values, an empty
+// position matches every topic.
+type LogScanConfig struct {
+	Addresses  []string   `toml:"addresses"`   // Contracts emitting the logs (empty = all)
+	Topics     [][]string `toml:"topics"`      // Values accepted for topic0..topic3 (empty = any)
+	BlockRange uint64     `toml:"block_range"` // Blocks per request (halved for ranges with too many results)
+}
+
+// TraceScanConfig configures the tracing of the transactions of the block
+// range of the block scan with the callTracer.
+type TraceScanConfig struct {
+	BatchSize uint64 `toml:"batch_size"` // Maximum batch size for requests (shrunk adaptively on errors)
+	Timeout   string `toml:"timeout"`    // Tracer timeout per block, e.g. "60s" (empty = node default)
+}
+
 type ScanConfig struct {
 	BlockScanConfig        `toml:"block_scan"`         // Configuration for block scanning
 	AccountScanConfig      `toml:"account_scan"`       // Configuration for account scanning
 	ReceiptScanConfig      `toml:"receipt_scan"`       // Configuration for receipt scanning
 	ContractCodeScanConfig `toml:"contract_code_scan"` // Configuration for contract code scanning
+	LogScanConfig          `toml:"log_scan"`           // Configuration for log scanning
+	TraceScanConfig        `toml:"trace_scan"`         // Configuration for internal transaction tracing
 	OutputDir              string                      `toml:"output_dir"` // Directory to save the output files
+	Decoder                string                      `toml:"decoder"`    // How blocks and receipts are decoded: "rpc" or "native" (go-ethereum types)
 }
 
 type FilterConfig struct {
@@ -84,27 +194,57 @@ func CreateSampleConfig() error {
 	sampleConfig := new(Config)
 
 	sampleConfig.Rpc.Url = DefaultRpcUrl
-	sampleConfig.Rpc.Delay = DefaultRpcDelay
+	sampleConfig.Rpc.Endpoints = []EndpointConfig{{Url: DefaultRpcUrl, Weight: 1}}
+	sampleConfig.Rpc.Strategy = DefaultPoolStrategy
+	sampleConfig.Rpc.HealthCheckInterval = DefaultHealthCheckInterval
+	sampleConfig.Rpc.MaxBlockLag = DefaultMaxBlockLag
+	sampleConfig.Rpc.RateLimit.RequestsPerSecond = DefaultRequestsPerSecond
+	sampleConfig.Rpc.RateLimit.MinFactor = DefaultRateLimitMinFactor
+	sampleConfig.Rpc.RateLimit.RecoveryStep = DefaultRateLimitRecoveryStep
+	sampleConfig.Rpc.Workers = DefaultWorkers
+	sampleConfig.Rpc.Timeout = DefaultRequestTimeout
+	sampleConfig.Rpc.Retry.MaxAttempts = DefaultRetryMaxAttempts
+	sampleConfig.Rpc.Retry.InitialBackoff = DefaultRetryInitialBackoff
+	sampleConfig.Rpc.Retry.MaxBackoff = DefaultRetryMaxBackoff
+	sampleConfig.Rpc.Retry.Jitter = DefaultRetryJitter
 
 	sampleConfig.Scan.BlockScanConfig.FromBlock = DefaultFromBlock
 	sampleConfig.Scan.BlockScanConfig.ToBlock = DefaultToBlock
 	sampleConfig.Scan.BlockScanConfig.OutputFileName = "full_blocks.json"
 	sampleConfig.Scan.BlockScanConfig.BatchSize = DefaultBatchSize
+	sampleConfig.Scan.BlockScanConfig.GapRetries = DefaultGapRetries
+	sampleConfig.Scan.BlockScanConfig.CheckpointInterval = DefaultCheckpointInterval
+	sampleConfig.Scan.BlockScanConfig.OutputFormat = OutputFormatJSON
+	sampleConfig.Scan.BlockScanConfig.RotateBlocks = DefaultRotateBlocks
+	sampleConfig.Scan.BlockScanConfig.TrustedBlocks = []TrustedBlock{}
 
 	sampleConfig.Scan.AccountScanConfig.BlockNumber = DefaultAccountScanBlockNumber
 	sampleConfig.Scan.AccountScanConfig.MaxAccounts = 100
 	sampleConfig.Scan.AccountScanConfig.StartKey = "AAAAAA==" // Base64 encoded string 0x0
 	sampleConfig.Scan.AccountScanConfig.OutputFileName = "accounts.json"
 	sampleConfig.Scan.AccountScanConfig.BatchSize = DefaultBatchSize
+	sampleConfig.Scan.AccountScanConfig.Partitions = DefaultAccountPartitions
+	sampleConfig.Scan.AccountScanConfig.Filter.Mode = DefaultAccountFilterMode
+	sampleConfig.Scan.AccountScanConfig.Filter.MinBalance = DefaultAccountMinBalance
+	sampleConfig.Scan.AccountScanConfig.Filter.CodeHashes = []string{}
+	sampleConfig.Scan.AccountScanConfig.Filter.ExcludeCodeHashes = []string{}
 
 	sampleConfig.Scan.ReceiptScanConfig.FullBlocksFile = "full_blocks.json"
 	sampleConfig.Scan.ReceiptScanConfig.OutputFileName = "receipts.json"
-	sampleConfig.Scan.ReceiptScanConfig.BatchSize = DefaultBatchSize
+	sampleConfig.Scan.ReceiptScanConfig.BatchSize = DefaultReceiptBatchSize
+	sampleConfig.Scan.ReceiptScanConfig.Method = DefaultReceiptMethod
 
 	sampleConfig.Scan.ContractCodeScanConfig.OutputFileName = "contract_codes.json"
 	sampleConfig.Scan.ContractCodeScanConfig.BatchSize = 1
 
+	sampleConfig.Scan.LogScanConfig.Addresses = []string{}
+	sampleConfig.Scan.LogScanConfig.Topics = [][]string{}
+	sampleConfig.Scan.LogScanConfig.BlockRange = DefaultLogBlockRange
+
+	sampleConfig.Scan.TraceScanConfig.BatchSize = DefaultBatchSize
+
 	sampleConfig.Scan.OutputDir = DefaultOutputDir
+	sampleConfig.Scan.Decoder = DefaultDecoder
 
 	sampleConfig.Filter.Addresses = DefaultFilterAddresses
 
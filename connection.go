@@ -26,16 +26,35 @@ func GetEthClient(path string) (*ethclient.Client, error) {
 }
 
 func TestConnection(config *Config) error {
-	client, err := GetEthClient(config.Rpc.Url)
+	failed := 0
+
+	for _, endpoint := range config.Rpc.endpointConfigs() {
+		if err := testEndpoint(endpoint.Url); err != nil {
+			fmt.Printf("Failed to connect to %s: %v\n", endpoint.Url, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d endpoints failed", failed, len(config.Rpc.endpointConfigs()))
+	}
+
+	return nil
+}
+
+func testEndpoint(url string) error {
+	client, err := GetEthClient(url)
 	if err != nil {
 		return err
 	}
 
+	defer client.Close()
+
 	blockNumber, err := GetLastBlockNumber(client)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Successfully connected to RPC server. Last block number: %s\n", blockNumber)
+	fmt.Printf("Successfully connected to %s. Last block number: %s\n", url, blockNumber)
 	return nil
 }
@@ -1,6 +1,9 @@
 package main
 
-import "math/big"
+import (
+	"encoding/json"
+	"math/big"
+)
 
 /* =========================================================================== */
 /* ====================== RPC Response Data Structures ======================= */
@@ -8,69 +11,115 @@ import "math/big"
 
 // RpcBlockFull has the full block data (full transactions)
 type RpcBlockFull struct {
-	Difficulty       string               `json:"difficulty"`
-	ExtraData        string               `json:"extraData"`
-	GasLimit         string               `json:"gasLimit"`
-	GasUsed          string               `json:"gasUsed"`
-	Hash             string               `json:"hash"`
-	LogsBloom        string               `json:"logsBloom"`
-	Miner            string               `json:"miner"`
-	MixHash          string               `json:"mixHash"`
-	Nonce            string               `json:"nonce"`
-	Number           string               `json:"number"`
-	ParentHash       string               `json:"parentHash"`
-	ReceiptsRoot     string               `json:"receiptsRoot"`
-	Sha3Uncles       string               `json:"sha3Uncles"`
-	Size             string               `json:"size"`
-	StateRoot        string               `json:"stateRoot"`
-	Timestamp        string               `json:"timestamp"`
-	TotalDifficulty  string               `json:"totalDifficulty"`
-	Transactions     []RpcTransactionFull `json:"transactions"`
-	TransactionsRoot string               `json:"transactionsRoot"`
-	Uncles           []string             `json:"uncles"`
+	Difficulty            string               `json:"difficulty"`
+	ExtraData             string               `json:"extraData"`
+	GasLimit              string               `json:"gasLimit"`
+	GasUsed               string               `json:"gasUsed"`
+	Hash                  string               `json:"hash"`
+	LogsBloom             string               `json:"logsBloom"`
+	Miner                 string               `json:"miner"`
+	MixHash               string               `json:"mixHash"`
+	Nonce                 string               `json:"nonce"`
+	Number                string               `json:"number"`
+	ParentHash            string               `json:"parentHash"`
+	ReceiptsRoot          string               `json:"receiptsRoot"`
+	Sha3Uncles            string               `json:"sha3Uncles"`
+	Size                  string               `json:"size"`
+	StateRoot             string               `json:"stateRoot"`
+	Timestamp             string               `json:"timestamp"`
+	TotalDifficulty       string               `json:"totalDifficulty"`
+	Transactions          []RpcTransactionFull `json:"transactions"`
+	TransactionsRoot      string               `json:"transactionsRoot"`
+	Uncles                []string             `json:"uncles"`
+	BaseFeePerGas         string               `json:"baseFeePerGas"`
+	BlobGasUsed           string               `json:"blobGasUsed"`
+	ExcessBlobGas         string               `json:"excessBlobGas"`
+	ParentBeaconBlockRoot string               `json:"parentBeaconBlockRoot"`
+	Withdrawals           []RpcWithdrawal      `json:"withdrawals"`
+	WithdrawalsRoot       string               `json:"withdrawalsRoot"`
+	RequestsHash          string               `json:"requestsHash"`
+	Raw                   json.RawMessage      `json:"-"` // The response as returned by the node
 }
 
 type RpcTransactionFull struct {
-	BlockHash        string `json:"blockHash"`
-	BlockNumber      string `json:"blockNumber"`
-	From             string `json:"from"`
-	Gas              string `json:"gas"`
-	GasPrice         string `json:"gasPrice"`
-	Hash             string `json:"hash"`
-	Input            string `json:"input"`
-	Nonce            string `json:"nonce"`
-	To               string `json:"to"`
-	TransactionIndex string `json:"transactionIndex"`
-	Value            string `json:"value"`
-	Type             string `json:"type"`
-	ChainId          string `json:"chainId"`
-	V                string `json:"v"`
-	R                string `json:"r"`
-	S                string `json:"s"`
+	BlockHash            string             `json:"blockHash"`
+	BlockNumber          string             `json:"blockNumber"`
+	From                 string             `json:"from"`
+	Gas                  string             `json:"gas"`
+	GasPrice             string             `json:"gasPrice"`
+	Hash                 string             `json:"hash"`
+	Input                string             `json:"input"`
+	Nonce                string             `json:"nonce"`
+	To                   string             `json:"to"`
+	TransactionIndex     string             `json:"transactionIndex"`
+	Value                string             `json:"value"`
+	Type                 string             `json:"type"`
+	ChainId              string             `json:"chainId"`
+	MaxFeePerGas         string             `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string             `json:"maxPriorityFeePerGas"`
+	AccessList           []AccessTuple      `json:"accessList"`
+	MaxFeePerBlobGas     string             `json:"maxFeePerBlobGas"`
+	BlobVersionedHashes  []string           `json:"blobVersionedHashes"`
+	AuthorizationList    []RpcAuthorization `json:"authorizationList"`
+	V                    string             `json:"v"`
+	R                    string             `json:"r"`
+	S                    string             `json:"s"`
+	YParity              string             `json:"yParity"`
+}
+
+// AccessTuple is an entry of the access list of a typed transaction (EIP-2930)
+type AccessTuple struct {
+	Address     string   `json:"address"`
+	StorageKeys []string `json:"storageKeys"`
+}
+
+// RpcAuthorization is an entry of the authorization list of a set-code transaction (EIP-7702)
+type RpcAuthorization struct {
+	ChainId string `json:"chainId"`
+	Address string `json:"address"`
+	Nonce   string `json:"nonce"`
+	YParity string `json:"yParity"`
+	R       string `json:"r"`
+	S       string `json:"s"`
 }
 
 // RpcBlockMinimal has the minimal block data (Only tx hashes)
 type RpcBlockMinimal struct {
-	Difficulty       string   `json:"difficulty"`
-	ExtraData        string   `json:"extraData"`
-	GasLimit         string   `json:"gasLimit"`
-	GasUsed          string   `json:"gasUsed"`
-	Hash             string   `json:"hash"`
-	LogsBloom        string   `json:"logsBloom"`
-	Miner            string   `json:"miner"`
-	MixHash          string   `json:"mixHash"`
-	Nonce            string   `json:"nonce"`
-	Number           string   `json:"number"`
-	ParentHash       string   `json:"parentHash"`
-	ReceiptsRoot     string   `json:"receiptsRoot"`
-	Sha3Uncles       string   `json:"sha3Uncles"`
-	Size             string   `json:"size"`
-	StateRoot        string   `json:"stateRoot"`
-	Timestamp        string   `json:"timestamp"`
-	TotalDifficulty  string   `json:"totalDifficulty"`
-	Transactions     []string `json:"transactions"`
-	TransactionsRoot string   `json:"transactionsRoot"`
-	Uncles           []string `json:"uncles"`
+	Difficulty            string          `json:"difficulty"`
+	ExtraData             string          `json:"extraData"`
+	GasLimit              string          `json:"gasLimit"`
+	GasUsed               string          `json:"gasUsed"`
+	Hash                  string          `json:"hash"`
+	LogsBloom             string          `json:"logsBloom"`
+	Miner                 string          `json:"miner"`
+	MixHash               string          `json:"mixHash"`
+	Nonce                 string          `json:"nonce"`
+	Number                string          `json:"number"`
+	ParentHash            string          `json:"parentHash"`
+	ReceiptsRoot          string          `json:"receiptsRoot"`
+	Sha3Uncles            string          `json:"sha3Uncles"`
+	Size                  string          `json:"size"`
+	StateRoot             string          `json:"stateRoot"`
+	Timestamp             string          `json:"timestamp"`
+	TotalDifficulty       string          `json:"totalDifficulty"`
+	Transactions          []string        `json:"transactions"`
+	TransactionsRoot      string          `json:"transactionsRoot"`
+	Uncles                []string        `json:"uncles"`
+	BaseFeePerGas         string          `json:"baseFeePerGas"`
+	BlobGasUsed           string          `json:"blobGasUsed"`
+	ExcessBlobGas         string          `json:"excessBlobGas"`
+	ParentBeaconBlockRoot string          `json:"parentBeaconBlockRoot"`
+	Withdrawals           []RpcWithdrawal `json:"withdrawals"`
+	WithdrawalsRoot       string          `json:"withdrawalsRoot"`
+	RequestsHash          string          `json:"requestsHash"`
+}
+
+// RpcWithdrawal is a validator withdrawal included in a block (EIP-4895)
+type RpcWithdrawal struct {
+	Index          string `json:"index"`
+	ValidatorIndex string `json:"validatorIndex"`
+	Address        string `json:"address"`
+	Amount         string `json:"amount"`
 }
 
 type RpcLog struct {
@@ -86,20 +135,55 @@ type RpcLog struct {
 }
 
 type RpcReceipt struct {
-	BlockHash         string   `json:"blockHash"`
-	BlockNumber       string   `json:"blockNumber"`
-	ContractAddress   string   `json:"contractAddress"`
-	CumulativeGasUsed string   `json:"cumulativeGasUsed"`
-	GasUsed           string   `json:"gasUsed"`
-	Status            string   `json:"status"`
-	To                string   `json:"to"`
-	TransactionHash   string   `json:"transactionHash"`
-	TransactionIndex  string   `json:"transactionIndex"`
-	Logs              []RpcLog `json:"logs"`
-	LogsBloom         string   `json:"logsBloom"`
-	From              string   `json:"from"`
-	EffectiveGasPrice string   `json:"effectiveGasPrice"`
-	Type              string   `json:"type"`
+	BlockHash         string          `json:"blockHash"`
+	BlockNumber       string          `json:"blockNumber"`
+	ContractAddress   string          `json:"contractAddress"`
+	CumulativeGasUsed string          `json:"cumulativeGasUsed"`
+	GasUsed           string          `json:"gasUsed"`
+	Status            string          `json:"status"`
+	Root              string          `json:"root"`
+	To                string          `json:"to"`
+	TransactionHash   string          `json:"transactionHash"`
+	TransactionIndex  string          `json:"transactionIndex"`
+	Logs              []RpcLog        `json:"logs"`
+	LogsBloom         string          `json:"logsBloom"`
+	From              string          `json:"from"`
+	EffectiveGasPrice string          `json:"effectiveGasPrice"`
+	Type              string          `json:"type"`
+	BlobGasUsed       string          `json:"blobGasUsed"`
+	BlobGasPrice      string          `json:"blobGasPrice"`
+	Raw               json.RawMessage `json:"-"` // The response as returned by the node
+}
+
+// RpcCallFrame is a call frame of the callTracer, with the frames of its subcalls.
+type RpcCallFrame struct {
+	Type         string         `json:"type"`
+	From         string         `json:"from"`
+	To           string         `json:"to"`
+	Value        string         `json:"value"`
+	Gas          string         `json:"gas"`
+	GasUsed      string         `json:"gasUsed"`
+	Input        string         `json:"input"`
+	Output       string         `json:"output"`
+	Error        string         `json:"error"`
+	RevertReason string         `json:"revertReason"`
+	Calls        []RpcCallFrame `json:"calls"`
+}
+
+// RpcTransactionTrace is the trace of one transaction of debug_traceBlockByHash.
+// Nodes that predate txHash in block traces only return the result.
+type RpcTransactionTrace struct {
+	TxHash string        `json:"txHash"`
+	Result *RpcCallFrame `json:"result"`
+	Error  string        `json:"error"`
+}
+
+// RpcBlockTraces holds the transaction traces of a block and the hashes of
+// its transactions, in transaction order.
+type RpcBlockTraces struct {
+	BlockNumber       *big.Int
+	TransactionHashes []string
+	Traces            []RpcTransactionTrace
 }
 
 /* ========================================================================== */
@@ -107,68 +191,115 @@ type RpcReceipt struct {
 /* ========================================================================== */
 
 type BlockFull struct {
-	Difficulty       *big.Int          `json:"difficulty"`
-	ExtraData        string            `json:"extraData"`
-	GasLimit         *big.Int          `json:"gasLimit"`
-	GasUsed          *big.Int          `json:"gasUsed"`
-	Hash             string            `json:"hash"`
-	LogsBloom        string            `json:"logsBloom"`
-	Miner            string            `json:"miner"`
-	MixHash          string            `json:"mixHash"`
-	Nonce            *big.Int          `json:"nonce"`
-	Number           *big.Int          `json:"number"`
-	ParentHash       string            `json:"parentHash"`
-	ReceiptsRoot     string            `json:"receiptsRoot"`
-	Sha3Uncles       string            `json:"sha3Uncles"`
-	Size             *big.Int          `json:"size"`
-	StateRoot        string            `json:"stateRoot"`
-	Timestamp        *big.Int          `json:"timestamp"`
-	TotalDifficulty  *big.Int          `json:"totalDifficulty"`
-	TransactionsRoot string            `json:"transactionsRoot"`
-	Uncles           []string          `json:"uncles"`
-	Transactions     []TransactionFull `json:"transactions"`
+	Difficulty            *big.Int          `json:"difficulty"`
+	ExtraData             string            `json:"extraData"`
+	GasLimit              *big.Int          `json:"gasLimit"`
+	GasUsed               *big.Int          `json:"gasUsed"`
+	Hash                  string            `json:"hash"`
+	LogsBloom             string            `json:"logsBloom"`
+	Miner                 string            `json:"miner"`
+	MixHash               string            `json:"mixHash"`
+	Nonce                 *big.Int          `json:"nonce"`
+	Number                *big.Int          `json:"number"`
+	ParentHash            string            `json:"parentHash"`
+	ReceiptsRoot          string            `json:"receiptsRoot"`
+	Sha3Uncles            string            `json:"sha3Uncles"`
+	Size                  *big.Int          `json:"size"`
+	StateRoot             string            `json:"stateRoot"`
+	Timestamp             *big.Int          `json:"timestamp"`
+	TotalDifficulty       *big.Int          `json:"totalDifficulty"`
+	TransactionsRoot      string            `json:"transactionsRoot"`
+	Uncles                []string          `json:"uncles"`
+	BaseFeePerGas         *big.Int          `json:"baseFeePerGas"`
+	BlobGasUsed           *big.Int          `json:"blobGasUsed"`
+	ExcessBlobGas         *big.Int          `json:"excessBlobGas"`
+	ParentBeaconBlockRoot string            `json:"parentBeaconBlockRoot"`
+	WithdrawalsRoot       string            `json:"withdrawalsRoot"`
+	RequestsHash          string            `json:"requestsHash"`
+	Withdrawals           []Withdrawal      `json:"withdrawals"`
+	Transactions          []TransactionFull `json:"transactions"`
 }
 
 type TransactionFull struct {
-	BlockHash        string   `json:"blockHash"`
-	BlockNumber      *big.Int `json:"blockNumber"`
-	From             string   `json:"from"`
-	Gas              *big.Int `json:"gas"`
-	GasPrice         *big.Int `json:"gasPrice"`
-	Hash             string   `json:"hash"`
-	Input            string   `json:"input"`
-	Nonce            *big.Int `json:"nonce"`
-	To               string   `json:"to"`
-	TransactionIndex *big.Int `json:"transactionIndex"`
-	Value            *big.Int `json:"value"`
-	Type             *big.Int `json:"type"`
-	ChainId          *big.Int `json:"chainId"`
-	V                string   `json:"v"`
-	R                string   `json:"r"`
-	S                string   `json:"s"`
+	BlockHash            string          `json:"blockHash"`
+	BlockNumber          *big.Int        `json:"blockNumber"`
+	From                 string          `json:"from"`
+	Gas                  *big.Int        `json:"gas"`
+	GasPrice             *big.Int        `json:"gasPrice"`
+	Hash                 string          `json:"hash"`
+	Input                string          `json:"input"`
+	Nonce                *big.Int        `json:"nonce"`
+	To                   string          `json:"to"`
+	TransactionIndex     *big.Int        `json:"transactionIndex"`
+	Value                *big.Int        `json:"value"`
+	Type                 *big.Int        `json:"type"`
+	ChainId              *big.Int        `json:"chainId"`
+	MaxFeePerGas         *big.Int        `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *big.Int        `json:"maxPriorityFeePerGas"`
+	AccessList           []AccessTuple   `json:"accessList"`
+	MaxFeePerBlobGas     *big.Int        `json:"maxFeePerBlobGas"`
+	BlobVersionedHashes  []string        `json:"blobVersionedHashes"`
+	AuthorizationList    []Authorization `json:"authorizationList"`
+	V                    string          `json:"v"`
+	R                    string          `json:"r"`
+	S                    string          `json:"s"`
+	YParity              string          `json:"yParity"`
 }
 
 type BlockMinimal struct {
-	Difficulty       *big.Int `json:"difficulty"`
-	ExtraData        string   `json:"extraData"`
-	GasLimit         *big.Int `json:"gasLimit"`
-	GasUsed          *big.Int `json:"gasUsed"`
-	Hash             string   `json:"hash"`
-	LogsBloom        string   `json:"logsBloom"`
-	Miner            string   `json:"miner"`
-	MixHash          string   `json:"mixHash"`
-	Nonce            *big.Int `json:"nonce"`
-	Number           *big.Int `json:"number"`
-	ParentHash       string   `json:"parentHash"`
-	ReceiptsRoot     string   `json:"receiptsRoot"`
-	Sha3Uncles       string   `json:"sha3Uncles"`
-	Size             *big.Int `json:"size"`
-	StateRoot        string   `json:"stateRoot"`
-	Timestamp        *big.Int `json:"timestamp"`
-	TotalDifficulty  *big.Int `json:"totalDifficulty"`
-	TransactionsRoot string   `json:"transactionsRoot"`
-	Uncles           []string `json:"uncles"`
-	Transactions     []string `json:"transactions"`
+	Difficulty            *big.Int     `json:"difficulty"`
+	ExtraData             string       `json:"extraData"`
+	GasLimit              *big.Int     `json:"gasLimit"`
+	GasUsed               *big.Int     `json:"gasUsed"`
+	Hash                  string       `json:"hash"`
+	LogsBloom             string       `json:"logsBloom"`
+	Miner                 string       `json:"miner"`
+	MixHash               string       `json:"mixHash"`
+	Nonce                 *big.Int     `json:"nonce"`
+	Number                *big.Int     `json:"number"`
+	ParentHash            string       `json:"parentHash"`
+	ReceiptsRoot          string       `json:"receiptsRoot"`
+	Sha3Uncles            string       `json:"sha3Uncles"`
+	Size                  *big.Int     `json:"size"`
+	StateRoot             string       `json:"stateRoot"`
+	Timestamp             *big.Int     `json:"timestamp"`
+	TotalDifficulty       *big.Int     `json:"totalDifficulty"`
+	TransactionsRoot      string       `json:"transactionsRoot"`
+	Uncles                []string     `json:"uncles"`
+	BaseFeePerGas         *big.Int     `json:"baseFeePerGas"`
+	BlobGasUsed           *big.Int     `json:"blobGasUsed"`
+	ExcessBlobGas         *big.Int     `json:"excessBlobGas"`
+	ParentBeaconBlockRoot string       `json:"parentBeaconBlockRoot"`
+	WithdrawalsRoot       string       `json:"withdrawalsRoot"`
+	RequestsHash          string       `json:"requestsHash"`
+	Withdrawals           []Withdrawal `json:"withdrawals"`
+	Transactions          []string     `json:"transactions"`
+}
+
+// Authorization is a decoded authorization tuple. Authority is the account
+// recovered from the signature, empty when the signature is invalid.
+type Authorization struct {
+	ChainId   *big.Int `json:"chainId"`
+	Address   string   `json:"address"`
+	Nonce     *big.Int `json:"nonce"`
+	YParity   string   `json:"yParity"`
+	R         string   `json:"r"`
+	S         string   `json:"s"`
+	Authority string   `json:"authority"`
+}
+
+type Withdrawal struct {
+	Index          *big.Int `json:"index"`
+	ValidatorIndex *big.Int `json:"validatorIndex"`
+	Address        string   `json:"address"`
+	Amount         *big.Int `json:"amount"` // In gwei
+}
+
+// BlockWithdrawal is a withdrawal along with its block, as saved in the withdrawals output
+type BlockWithdrawal struct {
+	BlockNumber *big.Int `json:"blockNumber"`
+	BlockHash   string   `json:"blockHash"`
+	Withdrawal
 }
 
 type Log struct {
@@ -190,6 +321,7 @@ type Receipt struct {
 	CumulativeGasUsed *big.Int `json:"cumulativeGasUsed"`
 	GasUsed           *big.Int `json:"gasUsed"`
 	Status            string   `json:"status"`
+	Root              string   `json:"root"`
 	To                string   `json:"to"`
 	TransactionHash   string   `json:"transactionHash"`
 	TransactionIndex  *big.Int `json:"transactionIndex"`
@@ -198,6 +330,29 @@ type Receipt struct {
 	From              string   `json:"from"`
 	EffectiveGasPrice *big.Int `json:"effectiveGasPrice"`
 	Type              *big.Int `json:"type"`
+	BlobGasUsed       *big.Int `json:"blobGasUsed"`
+	BlobGasPrice      *big.Int `json:"blobGasPrice"`
+}
+
+// InternalTransaction is a flattened call frame of a transaction trace. The
+// top call of the transaction has an empty TraceAddress. Reverted is set when
+// the frame or one of its parents failed, in which case its value was not transferred.
+type InternalTransaction struct {
+	BlockNumber      *big.Int `json:"blockNumber"`
+	TransactionHash  string   `json:"transactionHash"`
+	TransactionIndex int      `json:"transactionIndex"`
+	TraceAddress     []int    `json:"traceAddress"` // Index of the frame among the subcalls of each of its parents
+	Type             string   `json:"type"`         // CALL, STATICCALL, DELEGATECALL, CALLCODE, CREATE, CREATE2 or SELFDESTRUCT
+	From             string   `json:"from"`
+	To               string   `json:"to"`
+	Value            *big.Int `json:"value"` // Nil for STATICCALL and DELEGATECALL, which transfer no value
+	Gas              *big.Int `json:"gas"`
+	GasUsed          *big.Int `json:"gasUsed"`
+	Input            string   `json:"input"`
+	Output           string   `json:"output"`
+	Error            string   `json:"error"`
+	RevertReason     string   `json:"revertReason"`
+	Reverted         bool     `json:"reverted"`
 }
 
 type FullTransaction struct {
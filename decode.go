@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// parseHexQuantity strictly decodes a 0x-prefixed hex quantity of at most 256 bits.
+func parseHexQuantity(value string) (*big.Int, error) {
+	if !strings.HasPrefix(value, "0x") && !strings.HasPrefix(value, "0X") {
+		return nil, fmt.Errorf("hex quantity %q has no 0x prefix", value)
+	}
+
+	digits := value[2:]
+	if digits == "" {
+		return nil, fmt.Errorf("hex quantity %q has no digits", value)
+	}
+
+	// SetString also accepts a sign, which is not valid in a quantity.
+	for _, c := range digits {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return nil, fmt.Errorf("invalid hex quantity %q", value)
+		}
+	}
+
+	quantity, ok := new(big.Int).SetString(digits, 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid hex quantity %q", value)
+	}
+
+	if quantity.BitLen() > 256 {
+		return nil, fmt.Errorf("hex quantity %q is larger than 256 bits", value)
+	}
+
+	return quantity, nil
+}
+
+// validateHexData checks that value is 0x-prefixed hex data. A size of 0
+// accepts data of any length, otherwise it must be exactly size bytes long.
+func validateHexData(value string, size int) error {
+	if !strings.HasPrefix(value, "0x") && !strings.HasPrefix(value, "0X") {
+		return fmt.Errorf("hex data %q has no 0x prefix", value)
+	}
+
+	digits := value[2:]
+	if len(digits)%2 != 0 {
+		return fmt.Errorf("hex data %q has an odd length", value)
+	}
+
+	for _, c := range digits {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return fmt.Errorf("invalid hex data %q", value)
+		}
+	}
+
+	if size > 0 && len(digits) != size*2 {
+		return fmt.Errorf("hex data %q is %d bytes long, expected %d", value, len(digits)/2, size)
+	}
+
+	return nil
+}
+
+// FieldDecoder strictly decodes the hex fields of an RPC response. The first
+// invalid field is recorded with its path (e.g. block.transactions[3].gasPrice),
+// so that a conversion can decode all of its fields and check Err once.
+// Nested decoders share the error of their parent.
+type FieldDecoder struct {
+	path string
+	err  *error
+}
+
+// NewFieldDecoder creates a decoder for the object at path.
+func NewFieldDecoder(path string) *FieldDecoder {
+	return &FieldDecoder{path: path, err: new(error)}
+}
+
+// Nested returns a decoder for a nested object, e.g. Nested("logs[%d]", i).
+func (d *FieldDecoder) Nested(format string, args ...any) *FieldDecoder {
+	return &FieldDecoder{path: d.path + "." + fmt.Sprintf(format, args...), err: d.err}
+}
+
+// Err returns the first decoding error, if any.
+func (d *FieldDecoder) Err() error {
+	return *d.err
+}
+
+func (d *FieldDecoder) fail(field string, err error) {
+	if *d.err == nil {
+		*d.err = fmt.Errorf("%s.%s: %w", d.path, field, err)
+	}
+}
+
+// Quantity decodes a required hex quantity.
+func (d *FieldDecoder) Quantity(field string, value string) *big.Int {
+	if value == "" {
+		d.fail(field, fmt.Errorf("missing value"))
+		return nil
+	}
+
+	return d.OptionalQuantity(field, value)
+}
+
+// OptionalQuantity decodes a hex quantity that is absent in some blocks or
+// transaction types. An empty value decodes to nil.
+func (d *FieldDecoder) OptionalQuantity(field string, value string) *big.Int {
+	if value == "" {
+		return nil
+	}
+
+	quantity, err := parseHexQuantity(value)
+	if err != nil {
+		d.fail(field, err)
+		return nil
+	}
+
+	return quantity
+}
+
+// QuantityString validates a required hex quantity that is kept as a string.
+func (d *FieldDecoder) QuantityString(field string, value string) string {
+	d.Quantity(field, value)
+	return value
+}
+
+// OptionalQuantityString validates a hex quantity that is kept as a string, if present.
+func (d *FieldDecoder) OptionalQuantityString(field string, value string) string {
+	d.OptionalQuantity(field, value)
+	return value
+}
+
+// Data validates required hex data of any length.
+func (d *FieldDecoder) Data(field string, value string) string {
+	return d.fixedData(field, value, 0, false)
+}
+
+// OptionalData validates hex data of any length, if present.
+func (d *FieldDecoder) OptionalData(field string, value string) string {
+	return d.fixedData(field, value, 0, true)
+}
+
+// Hash validates a required 32-byte hash.
+func (d *FieldDecoder) Hash(field string, value string) string {
+	return d.fixedData(field, value, 32, false)
+}
+
+// OptionalHash validates a 32-byte hash, if present.
+func (d *FieldDecoder) OptionalHash(field string, value string) string {
+	return d.fixedData(field, value, 32, true)
+}
+
+// Hashes validates a list of 32-byte hashes.
+func (d *FieldDecoder) Hashes(field string, values []string) []string {
+	for i, value := range values {
+		d.Hash(fmt.Sprintf("%s[%d]", field, i), value)
+	}
+
+	return values
+}
+
+// Address validates a required 20-byte address.
+func (d *FieldDecoder) Address(field string, value string) string {
+	return d.fixedData(field, value, 20, false)
+}
+
+// OptionalAddress validates a 20-byte address, if present (e.g. the recipient
+// of a contract creation).
+func (d *FieldDecoder) OptionalAddress(field string, value string) string {
+	return d.fixedData(field, value, 20, true)
+}
+
+// Bloom validates a required 256-byte logs bloom.
+func (d *FieldDecoder) Bloom(field string, value string) string {
+	return d.fixedData(field, value, 256, false)
+}
+
+func (d *FieldDecoder) fixedData(field string, value string, size int, optional bool) string {
+	if value == "" {
+		if !optional {
+			d.fail(field, fmt.Errorf("missing value"))
+		}
+		return value
+	}
+
+	if err := validateHexData(value, size); err != nil {
+		d.fail(field, err)
+	}
+
+	return value
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHexQuantity(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "0x0", want: "0"},
+		{value: "0x1", want: "1"},
+		{value: "0xff", want: "255"},
+		{value: "0XFF", want: "255"},
+		{value: "0x00ff", want: "255"},
+		{value: "0x" + strings.Repeat("f", 64), want: "115792089237316195423570985008687907853269984665640564039457584007913129639935"},
+		{value: "0x1" + strings.Repeat("0", 64), wantErr: true},
+		{value: "", wantErr: true},
+		{value: "0x", wantErr: true},
+		{value: "ff", wantErr: true},
+		{value: "x0", wantErr: true},
+		{value: "0x+1", wantErr: true},
+		{value: "0x-0", wantErr: true},
+		{value: "0x-1", wantErr: true},
+		{value: "0x1_0", wantErr: true},
+		{value: "0x 1", wantErr: true},
+		{value: "0xg", wantErr: true},
+	}
+
+	for _, test := range tests {
+		quantity, err := parseHexQuantity(test.value)
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseHexQuantity(%q) = %s, want an error", test.value, quantity)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseHexQuantity(%q) failed: %v", test.value, err)
+			continue
+		}
+
+		if quantity.String() != test.want {
+			t.Errorf("parseHexQuantity(%q) = %s, want %s", test.value, quantity, test.want)
+		}
+	}
+}
+
+func TestValidateHexData(t *testing.T) {
+	tests := []struct {
+		value   string
+		size    int
+		wantErr bool
+	}{
+		{value: "0x", size: 0},
+		{value: "0x00", size: 0},
+		{value: "0xdeadBEEF", size: 0},
+		{value: "0X00", size: 1},
+		{value: "0x" + strings.Repeat("ab", 20), size: 20},
+		{value: "", size: 0, wantErr: true},
+		{value: "00", size: 0, wantErr: true},
+		{value: "0x0", size: 0, wantErr: true},
+		{value: "0x0g", size: 0, wantErr: true},
+		{value: "0x+1", size: 0, wantErr: true},
+		{value: "0x" + strings.Repeat("ab", 19), size: 20, wantErr: true},
+		{value: "0x" + strings.Repeat("ab", 21), size: 20, wantErr: true},
+	}
+
+	for _, test := range tests {
+		err := validateHexData(test.value, test.size)
+
+		if test.wantErr && err == nil {
+			t.Errorf("validateHexData(%q, %d) succeeded, want an error", test.value, test.size)
+		}
+
+		if !test.wantErr && err != nil {
+			t.Errorf("validateHexData(%q, %d) failed: %v", test.value, test.size, err)
+		}
+	}
+}
+
+func TestFieldDecoderErrors(t *testing.T) {
+	hash := "0x" + strings.Repeat("11", 32)
+
+	tests := []struct {
+		name    string
+		decode  func(d *FieldDecoder)
+		wantErr string // Prefix of the error, empty when decoding succeeds
+	}{
+		{
+			name: "valid fields",
+			decode: func(d *FieldDecoder) {
+				d.Quantity("number", "0x1")
+				d.Hash("hash", hash)
+				d.Hashes("transactions", []string{hash, hash})
+			},
+		},
+		{
+			name: "absent optional fields",
+			decode: func(d *FieldDecoder) {
+				d.OptionalQuantity("baseFeePerGas", "")
+				d.OptionalHash("withdrawalsRoot", "")
+				d.OptionalAddress("to", "")
+				d.OptionalData("output", "")
+			},
+		},
+		{
+			name:    "missing quantity",
+			decode:  func(d *FieldDecoder) { d.Quantity("number", "") },
+			wantErr: "block.number: missing value",
+		},
+		{
+			name:    "missing hash",
+			decode:  func(d *FieldDecoder) { d.Hash("hash", "") },
+			wantErr: "block.hash: missing value",
+		},
+		{
+			name:    "signed quantity",
+			decode:  func(d *FieldDecoder) { d.OptionalQuantity("gasUsed", "0x+1") },
+			wantErr: "block.gasUsed: invalid hex quantity",
+		},
+		{
+			name:    "short address",
+			decode:  func(d *FieldDecoder) { d.OptionalAddress("miner", "0x1234") },
+			wantErr: "block.miner: hex data \"0x1234\" is 2 bytes long",
+		},
+		{
+			name:    "invalid list element",
+			decode:  func(d *FieldDecoder) { d.Hashes("transactions", []string{hash, "0x12"}) },
+			wantErr: "block.transactions[1]:",
+		},
+		{
+			name: "nested path",
+			decode: func(d *FieldDecoder) {
+				d.Nested("transactions[%d]", 3).Quantity("gasPrice", "0xzz")
+			},
+			wantErr: "block.transactions[3].gasPrice:",
+		},
+		{
+			name: "first error is kept",
+			decode: func(d *FieldDecoder) {
+				d.Quantity("number", "0x1")
+				d.Nested("withdrawals[%d]", 0).Address("address", "")
+				d.Quantity("gasLimit", "0xzz")
+			},
+			wantErr: "block.withdrawals[0].address: missing value",
+		},
+	}
+
+	for _, test := range tests {
+		d := NewFieldDecoder("block")
+		test.decode(d)
+
+		err := d.Err()
+
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case test.wantErr != "" && err == nil:
+			t.Errorf("%s: no error, want %q", test.name, test.wantErr)
+		case test.wantErr != "" && !strings.HasPrefix(err.Error(), test.wantErr):
+			t.Errorf("%s: error %q, want %q", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/ethclient"
@@ -23,7 +25,9 @@ func GetLastBlockNumber(client *ethclient.Client) (string, error) {
 }
 
 // GetBlocksBatch retrieves a batch of blocks from the Ethereum client.
-func GetBlocksBatch(client *rpc.Client, blocks []*big.Int) ([]RpcBlockFull, error) {
+// Blocks that could not be fetched after all retries are returned as failed requests.
+// The blocks are sent in sub-batches of the effective size of sizer (nil sends a single batch).
+func GetBlocksBatch(client *RpcPool, blocks []*big.Int, retry RetryConfig, sizer *AdaptiveBatchSize) ([]RpcBlockFull, []FailedRequest) {
 	var batch []rpc.BatchElem
 
 	for _, block := range blocks {
@@ -36,17 +40,12 @@ func GetBlocksBatch(client *rpc.Client, blocks []*big.Int) ([]RpcBlockFull, erro
 		})
 	}
 
-	err := client.BatchCall(batch)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute batch call: %w", err)
-	}
+	failures := BatchCallWithRetry(client, batch, retry, sizer)
 
 	responses := make([]RpcBlockFull, 0)
 
 	for _, elem := range batch {
 		if elem.Error != nil {
-			log.Printf("error in batch element: %v", elem.Error)
 			continue
 		}
 
@@ -58,17 +57,19 @@ func GetBlocksBatch(client *rpc.Client, blocks []*big.Int) ([]RpcBlockFull, erro
 		response := &RpcBlockFull{}
 		if err := json.Unmarshal(*raw, &response); err != nil {
 			log.Printf("failed to unmarshal JSON: %v", err)
+			failures = append(failures, newDecodeFailure(elem, err))
 			continue
 		}
 
+		response.Raw = *raw
 		responses = append(responses, *response)
 	}
 
-	return responses, nil
+	return responses, failures
 }
 
 // GetReceiptsBatch retrieves a batch of transaction receipts from the Ethereum client.
-func GetReceiptsBatch(client *rpc.Client, transactions []string) ([]RpcReceipt, error) {
+func GetReceiptsBatch(client *RpcPool, transactions []string, retry RetryConfig, sizer *AdaptiveBatchSize) ([]RpcReceipt, []FailedRequest) {
 	var batch []rpc.BatchElem
 
 	for _, transaction := range transactions {
@@ -80,17 +81,12 @@ func GetReceiptsBatch(client *rpc.Client, transactions []string) ([]RpcReceipt,
 		})
 	}
 
-	err := client.BatchCall(batch)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute batch call: %w", err)
-	}
+	failures := BatchCallWithRetry(client, batch, retry, sizer)
 
 	responses := make([]RpcReceipt, 0)
 
 	for _, elem := range batch {
 		if elem.Error != nil {
-			log.Printf("error in batch element: %v", elem.Error)
 			continue
 		}
 
@@ -102,17 +98,220 @@ func GetReceiptsBatch(client *rpc.Client, transactions []string) ([]RpcReceipt,
 		var response RpcReceipt
 		if err := json.Unmarshal(*raw, &response); err != nil {
 			log.Printf("failed to unmarshal JSON: %v", err)
+			failures = append(failures, newDecodeFailure(elem, err))
 			continue
 		}
 
+		response.Raw = *raw
 		responses = append(responses, response)
 	}
 
-	return responses, nil
+	return responses, failures
+}
+
+// GetBlockReceiptsBatch retrieves all receipts of a batch of blocks, given by
+// hash or hex number, with one eth_getBlockReceipts call per block.
+func GetBlockReceiptsBatch(client *RpcPool, blocks []string, retry RetryConfig, sizer *AdaptiveBatchSize) ([]RpcReceipt, []FailedRequest) {
+	var batch []rpc.BatchElem
+
+	for _, block := range blocks {
+		var raw json.RawMessage
+		batch = append(batch, rpc.BatchElem{
+			Method: "eth_getBlockReceipts",
+			Args:   []any{block},
+			Result: &raw,
+		})
+	}
+
+	failures := BatchCallWithRetry(client, batch, retry, sizer)
+
+	responses := make([]RpcReceipt, 0)
+
+	for _, elem := range batch {
+		if elem.Error != nil {
+			continue
+		}
+
+		raw, ok := elem.Result.(*json.RawMessage)
+		if !ok || raw == nil {
+			continue
+		}
+
+		// Each receipt keeps its own raw response for the native decoder
+		var rawReceipts []json.RawMessage
+		if err := json.Unmarshal(*raw, &rawReceipts); err != nil {
+			log.Printf("failed to unmarshal JSON: %v", err)
+			failures = append(failures, newDecodeFailure(elem, err))
+			continue
+		}
+
+		blockReceipts := make([]RpcReceipt, len(rawReceipts))
+		var decodeErr error
+
+		for i, rawReceipt := range rawReceipts {
+			if decodeErr = json.Unmarshal(rawReceipt, &blockReceipts[i]); decodeErr != nil {
+				break
+			}
+
+			blockReceipts[i].Raw = rawReceipt
+		}
+
+		if decodeErr != nil {
+			log.Printf("failed to unmarshal JSON: %v", decodeErr)
+			failures = append(failures, newDecodeFailure(elem, decodeErr))
+			continue
+		}
+
+		responses = append(responses, blockReceipts...)
+	}
+
+	return responses, failures
+}
+
+// GetBlockTracesBatch traces the transactions of a batch of blocks. The blocks
+// are fetched by number first and then traced with debug_traceBlockByHash, so
+// that the traces and the transaction hashes, which older nodes do not return
+// with the traces, are of the same block even when the requests are answered
+// by different endpoints or around a reorg.
+// Blocks with a transaction whose trace failed are returned as failed requests.
+func GetBlockTracesBatch(client *RpcPool, blocks []*big.Int, options TraceOptions, retry RetryConfig, sizer *AdaptiveBatchSize) ([]RpcBlockTraces, []FailedRequest) {
+	var blockBatch []rpc.BatchElem
+
+	for _, block := range blocks {
+		var rawBlock json.RawMessage
+		blockBatch = append(blockBatch, rpc.BatchElem{
+			Method: "eth_getBlockByNumber",
+			Args:   []any{BigIntToHex(block), false},
+			Result: &rawBlock,
+		})
+	}
+
+	failures := BatchCallWithRetry(client, blockBatch, retry, sizer)
+
+	var traceBatch []rpc.BatchElem
+	traced := make([]RpcBlockTraces, 0, len(blocks))
+
+	for i, block := range blocks {
+		blockElem := blockBatch[i]
+
+		// A failed element is already in the failures
+		if blockElem.Error != nil {
+			continue
+		}
+
+		rawBlock, ok := blockElem.Result.(*json.RawMessage)
+		if !ok || rawBlock == nil {
+			continue
+		}
+
+		var rpcBlock RpcBlockMinimal
+		if err := json.Unmarshal(*rawBlock, &rpcBlock); err != nil {
+			log.Printf("failed to unmarshal JSON: %v", err)
+			failures = append(failures, newDecodeFailure(blockElem, err))
+			continue
+		}
+
+		if rpcBlock.Hash == "" {
+			err := fmt.Errorf("block not found")
+			log.Printf("failed to fetch block %s: %v", block, err)
+			failures = append(failures, newDecodeFailure(blockElem, err))
+			continue
+		}
+
+		var rawTraces json.RawMessage
+		traceBatch = append(traceBatch, rpc.BatchElem{
+			Method: "debug_traceBlockByHash",
+			Args:   []any{rpcBlock.Hash, options},
+			Result: &rawTraces,
+		})
+
+		traced = append(traced, RpcBlockTraces{BlockNumber: block, TransactionHashes: rpcBlock.Transactions})
+	}
+
+	failures = append(failures, BatchCallWithRetry(client, traceBatch, retry, sizer)...)
+
+	responses := make([]RpcBlockTraces, 0, len(traced))
+
+	for i, response := range traced {
+		elem := traceBatch[i]
+
+		if elem.Error != nil {
+			continue
+		}
+
+		raw, ok := elem.Result.(*json.RawMessage)
+		if !ok || raw == nil {
+			continue
+		}
+
+		if err := json.Unmarshal(*raw, &response.Traces); err != nil {
+			log.Printf("failed to unmarshal JSON: %v", err)
+			failures = append(failures, newDecodeFailure(elem, err))
+			continue
+		}
+
+		if len(response.Traces) != len(response.TransactionHashes) {
+			err := fmt.Errorf("%d traces for %d transactions", len(response.Traces), len(response.TransactionHashes))
+			log.Printf("failed to trace block %s: %v", response.BlockNumber, err)
+			failures = append(failures, newDecodeFailure(elem, err))
+			continue
+		}
+
+		traceFailed := false
+
+		for index, trace := range response.Traces {
+			if trace.Error != "" {
+				log.Printf("failed to trace transaction %d of block %s: %s", index, response.BlockNumber, trace.Error)
+				failures = append(failures, newDecodeFailure(elem, fmt.Errorf("traces[%d]: %s", index, trace.Error)))
+				traceFailed = true
+				break
+			}
+		}
+
+		if !traceFailed {
+			responses = append(responses, response)
+		}
+	}
+
+	return responses, failures
+}
+
+// isMethodNotFoundError reports whether the node does not implement the called method.
+func isMethodNotFoundError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601 {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+
+	return strings.Contains(message, "method not found") || strings.Contains(message, "does not exist") ||
+		strings.Contains(message, "not supported") || strings.Contains(message, "unsupported method")
+}
+
+// SupportsBlockReceipts reports whether the node answers eth_getBlockReceipts
+// for the given block (hash or hex number).
+func SupportsBlockReceipts(client *RpcPool, block string, retry RetryConfig) (bool, error) {
+	var raw json.RawMessage
+
+	err := CallWithRetryUnless(client, retry, isMethodNotFoundError, &raw, "eth_getBlockReceipts", block)
+
+	switch {
+	case err == nil:
+		return true, nil
+	case isMethodNotFoundError(err):
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to probe eth_getBlockReceipts: %w", err)
+	}
 }
 
 // GetContractCodeBatch retrieves the contract code for a batch of addresses from the Ethereum client.
-func GetContractCodeBatch(client *rpc.Client, addresses []string) ([]ContractCode, error) {
+func GetContractCodeBatch(client *RpcPool, addresses []string, retry RetryConfig, sizer *AdaptiveBatchSize) ([]ContractCode, []FailedRequest) {
 	var batch []rpc.BatchElem
 
 	for _, address := range addresses {
@@ -124,17 +323,12 @@ func GetContractCodeBatch(client *rpc.Client, addresses []string) ([]ContractCod
 		})
 	}
 
-	err := client.BatchCall(batch)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute batch call: %w", err)
-	}
+	failures := BatchCallWithRetry(client, batch, retry, sizer)
 
 	responses := make([]ContractCode, 0)
 
 	for i, elem := range batch {
 		if elem.Error != nil {
-			log.Printf("error in batch element: %v", elem.Error)
 			continue
 		}
 
@@ -146,6 +340,7 @@ func GetContractCodeBatch(client *rpc.Client, addresses []string) ([]ContractCod
 		var codeResponse string
 		if err := json.Unmarshal(*raw, &codeResponse); err != nil {
 			log.Printf("failed to unmarshal JSON: %v", err)
+			failures = append(failures, newDecodeFailure(elem, err))
 			continue
 		}
 
@@ -157,11 +352,11 @@ func GetContractCodeBatch(client *rpc.Client, addresses []string) ([]ContractCod
 		responses = append(responses, response)
 	}
 
-	return responses, nil
+	return responses, failures
 }
 
 // GetBalanceBatch retrieves the balance for a batch of addresses from the Ethereum client.
-func GetBalanceBatch(client *rpc.Client, addresses []string) ([]BalanceSheet, error) {
+func GetBalanceBatch(client *RpcPool, addresses []string, retry RetryConfig, sizer *AdaptiveBatchSize) ([]BalanceSheet, []FailedRequest) {
 	var batch []rpc.BatchElem
 
 	for _, address := range addresses {
@@ -173,17 +368,12 @@ func GetBalanceBatch(client *rpc.Client, addresses []string) ([]BalanceSheet, er
 		})
 	}
 
-	err := client.BatchCall(batch)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute batch call: %w", err)
-	}
+	failures := BatchCallWithRetry(client, batch, retry, sizer)
 
 	responses := make([]BalanceSheet, 0)
 
 	for i, elem := range batch {
 		if elem.Error != nil {
-			log.Printf("error in batch element: %v", elem.Error)
 			continue
 		}
 
@@ -195,6 +385,7 @@ func GetBalanceBatch(client *rpc.Client, addresses []string) ([]BalanceSheet, er
 		var balanceResponse string
 		if err := json.Unmarshal(*raw, &balanceResponse); err != nil {
 			log.Printf("failed to unmarshal JSON: %v", err)
+			failures = append(failures, newDecodeFailure(elem, err))
 			continue
 		}
 
@@ -206,6 +397,7 @@ func GetBalanceBatch(client *rpc.Client, addresses []string) ([]BalanceSheet, er
 
 		if err != nil {
 			log.Printf("failed to convert hex string to big.Int: %v", err)
+			failures = append(failures, newDecodeFailure(elem, err))
 			continue
 		}
 
@@ -218,5 +410,16 @@ func GetBalanceBatch(client *rpc.Client, addresses []string) ([]BalanceSheet, er
 		responses = append(responses, response)
 	}
 
-	return responses, nil
+	return responses, failures
+}
+
+// newDecodeFailure records a batch element whose result could not be decoded.
+// Decoding errors are deterministic, so these elements are not retried.
+func newDecodeFailure(elem rpc.BatchElem, err error) FailedRequest {
+	return FailedRequest{
+		Method:   elem.Method,
+		Args:     elem.Args,
+		Error:    err.Error(),
+		Attempts: 1,
+	}
 }
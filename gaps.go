@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// BlockGap is a contiguous range of blocks missing from a scan output.
+type BlockGap struct {
+	FromBlock uint64 `json:"fromBlock"`
+	ToBlock   uint64 `json:"toBlock"`
+}
+
+// GapsReport lists the blocks of a scanned range that could not be fetched.
+type GapsReport struct {
+	FromBlock     uint64     `json:"fromBlock"`
+	ToBlock       uint64     `json:"toBlock"`
+	MissingBlocks uint64     `json:"missingBlocks"`
+	Gaps          []BlockGap `json:"gaps"`
+}
+
+// gapRetries returns the configured number of gap re-fetch rounds, falling back to the default.
+func (b BlockScanConfig) gapRetries() uint64 {
+	if b.GapRetries == 0 {
+		return DefaultGapRetries
+	}
+
+	return b.GapRetries
+}
+
+// FetchBlocksComplete fetches the given blocks and verifies that every requested
+// number came back. Missing blocks are re-fetched up to gapRetries times.
+// It returns the blocks sorted by number, the failures of the blocks that are
+// still missing and the numbers of those blocks.
+func FetchBlocksComplete(client *RpcPool, blocks []*big.Int, retry RetryConfig, sizer *AdaptiveBatchSize, gapRetries uint64) ([]RpcBlockFull, []FailedRequest, []uint64) {
+	found := make(map[uint64]RpcBlockFull, len(blocks))
+	missing := blocks
+
+	var failures []FailedRequest
+
+	for round := uint64(0); len(missing) > 0 && round <= gapRetries; round++ {
+		if round > 0 {
+			log.Printf("Re-fetching %d missing blocks (round %d/%d)\n", len(missing), round, gapRetries)
+			time.Sleep(retry.backoff(round))
+		}
+
+		fetched, roundFailures := GetBlocksBatch(client, missing, retry, sizer)
+		failures = roundFailures
+
+		requested := make(map[uint64]bool, len(missing))
+		for _, number := range missing {
+			requested[number.Uint64()] = true
+		}
+
+		for _, block := range fetched {
+			number, err := HexToBigInt(block.Number)
+			if err != nil || number == nil || !requested[number.Uint64()] {
+				log.Printf("Ignoring unexpected block %q (hash %s)\n", block.Number, block.Hash)
+				continue
+			}
+
+			found[number.Uint64()] = block
+		}
+
+		stillMissing := make([]*big.Int, 0)
+		for _, number := range missing {
+			if _, ok := found[number.Uint64()]; !ok {
+				stillMissing = append(stillMissing, number)
+			}
+		}
+
+		missing = stillMissing
+	}
+
+	numbers := make([]uint64, 0, len(found))
+	for number := range found {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	result := make([]RpcBlockFull, len(numbers))
+	for i, number := range numbers {
+		result[i] = found[number]
+	}
+
+	missingNumbers := make([]uint64, len(missing))
+	missingArgs := make(map[string]bool, len(missing))
+	for i, number := range missing {
+		missingNumbers[i] = number.Uint64()
+		missingArgs[BigIntToHex(number)] = true
+	}
+
+	// Only keep the failures of the blocks that are still missing
+	remainingFailures := make([]FailedRequest, 0)
+	for _, failure := range failures {
+		if len(failure.Args) > 0 && missingArgs[fmt.Sprint(failure.Args[0])] {
+			remainingFailures = append(remainingFailures, failure)
+		}
+	}
+
+	return result, remainingFailures, missingNumbers
+}
+
+// NewGapsReport groups the missing block numbers of a range into contiguous gaps.
+func NewGapsReport(fromBlock uint64, toBlock uint64, missing []uint64) *GapsReport {
+	sorted := make([]uint64, len(missing))
+	copy(sorted, missing)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	report := &GapsReport{
+		FromBlock:     fromBlock,
+		ToBlock:       toBlock,
+		MissingBlocks: uint64(len(sorted)),
+		Gaps:          make([]BlockGap, 0),
+	}
+
+	for _, number := range sorted {
+		last := len(report.Gaps) - 1
+		if last >= 0 && report.Gaps[last].ToBlock+1 == number {
+			report.Gaps[last].ToBlock = number
+			continue
+		}
+
+		report.Gaps = append(report.Gaps, BlockGap{FromBlock: number, ToBlock: number})
+	}
+
+	return report
+}
@@ -9,21 +9,10 @@ import (
 	"strings"
 )
 
+// HexToBigInt strictly decodes a 0x-prefixed hex quantity. Malformed input,
+// including an empty string, returns an error.
 func HexToBigInt(hexString string) (*big.Int, error) {
-	hexString = strings.ToLower(hexString)
-
-	if !strings.HasPrefix(hexString, "0x") {
-		return nil, nil
-	}
-
-	sub := hexString[2:]
-	value := new(big.Int)
-
-	if _, ok := value.SetString(sub, 16); !ok {
-		return nil, nil
-	}
-
-	return value, nil
+	return parseHexQuantity(hexString)
 }
 
 func HexToBigIntMultiple(hexStrings []string) ([]*big.Int, error) {
@@ -121,6 +110,13 @@ func Base64ToBigInt(encodedStr string) (*big.Int, error) {
 	return num, nil
 }
 
+// BigIntToBase64Key converts a *big.Int* to a Base64 encoded 32-byte trie key.
+// Unlike BigIntToBase64 the bytes are left-padded with zeros, since the node
+// treats a shorter key as a prefix of the key space.
+func BigIntToBase64Key(num *big.Int) string {
+	return base64.StdEncoding.EncodeToString(num.FillBytes(make([]byte, 32)))
+}
+
 func TestBase64Conversion(num *big.Int) {
 	encoded := BigIntToBase64(num)
 	fmt.Println("Encoded:", encoded)
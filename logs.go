@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/schollz/progressbar/v3"
+)
+
+// Substrings of error messages used by providers to reject a log query that
+// covers too many blocks or returns too many logs.
+var logRangeMessages = []string{
+	"query returned more than",
+	"too many results",
+	"too many logs",
+	"response size",
+	"block range",
+	"range is too large",
+	"range too large",
+}
+
+// isLogRangeError reports whether a log query failed because its block range
+// was too large, so that it can be split instead of retried.
+func isLogRangeError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if isBatchSizeError(err) {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, logRangeMessage := range logRangeMessages {
+		if strings.Contains(message, logRangeMessage) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// blockRange returns the configured number of blocks per request, falling back to the default.
+func (l LogScanConfig) blockRange() uint64 {
+	if l.BlockRange == 0 {
+		return DefaultLogBlockRange
+	}
+
+	return l.BlockRange
+}
+
+// LogFilter is the filter object of an eth_getLogs request. Each topic
+// position is either nil (any topic) or the list of accepted topics.
+type LogFilter struct {
+	FromBlock string   `json:"fromBlock"`
+	ToBlock   string   `json:"toBlock"`
+	Address   []string `json:"address,omitempty"`
+	Topics    []any    `json:"topics,omitempty"`
+}
+
+// NewLogFilter validates the addresses and topics of the log scan and builds
+// the filter sent with every request.
+func NewLogFilter(logScan LogScanConfig) (LogFilter, error) {
+	filter := LogFilter{}
+
+	for _, address := range logScan.Addresses {
+		if err := validateHexData(address, 20); err != nil {
+			return filter, fmt.Errorf("invalid log address: %w", err)
+		}
+
+		filter.Address = append(filter.Address, strings.ToLower(address))
+	}
+
+	if len(logScan.Topics) > 4 {
+		return filter, fmt.Errorf("logs have at most 4 topics, got %d topic filters", len(logScan.Topics))
+	}
+
+	for i, topics := range logScan.Topics {
+		if len(topics) == 0 {
+			filter.Topics = append(filter.Topics, nil)
+			continue
+		}
+
+		position := make([]string, len(topics))
+
+		for j, topic := range topics {
+			if err := validateHexData(topic, 32); err != nil {
+				return filter, fmt.Errorf("invalid topic%d: %w", i, err)
+			}
+
+			position[j] = strings.ToLower(topic)
+		}
+
+		filter.Topics = append(filter.Topics, position)
+	}
+
+	// Trailing wildcards do not change the query
+	for len(filter.Topics) > 0 && filter.Topics[len(filter.Topics)-1] == nil {
+		filter.Topics = filter.Topics[:len(filter.Topics)-1]
+	}
+
+	return filter, nil
+}
+
+// LogRangeResult holds the eth_getLogs responses of a block range, one per
+// queried sub-range in block order.
+type LogRangeResult struct {
+	Responses []json.RawMessage
+	Requests  uint64
+	Splits    uint64
+	Failures  []FailedRequest
+}
+
+// GetLogsRange fetches the logs of fromBlock..toBlock. A range rejected for
+// having too many results is bisected until the node accepts its halves;
+// only single blocks are retried like other requests.
+func GetLogsRange(client *RpcPool, filter LogFilter, fromBlock uint64, toBlock uint64, retry RetryConfig, result *LogRangeResult) {
+	filter.FromBlock = hexutil.EncodeUint64(fromBlock)
+	filter.ToBlock = hexutil.EncodeUint64(toBlock)
+
+	splittable := func(err error) bool {
+		return fromBlock < toBlock && isLogRangeError(err)
+	}
+
+	var raw json.RawMessage
+
+	result.Requests++
+
+	err := CallWithRetryUnless(client, retry, splittable, &raw, "eth_getLogs", filter)
+
+	switch {
+	case err == nil:
+		result.Responses = append(result.Responses, raw)
+	case splittable(err):
+		middle := fromBlock + (toBlock-fromBlock)/2
+		result.Splits++
+
+		GetLogsRange(client, filter, fromBlock, middle, retry, result)
+		GetLogsRange(client, filter, middle+1, toBlock, retry, result)
+	default:
+		log.Printf("giving up on eth_getLogs for blocks %d to %d: %v", fromBlock, toBlock, err)
+
+		result.Failures = append(result.Failures, FailedRequest{
+			Method:   "eth_getLogs",
+			Args:     []any{filter},
+			Error:    err.Error(),
+			Attempts: retry.maxAttempts(),
+		})
+	}
+}
+
+// ScanLogsWithConfig fetches the logs matching the log filter over the block
+// range of the configuration with eth_getLogs and streams them to a JSON lines file.
+func ScanLogsWithConfig(config *Config, resume bool) error {
+	if err := validateConfig(config); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	filter, err := NewLogFilter(config.Scan.LogScanConfig)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	log.Printf("Starting the log scanner...\n")
+
+	startBlock := config.Scan.FromBlock
+	endBlock := config.Scan.ToBlock
+
+	blockRange := config.Scan.LogScanConfig.blockRange()
+	totalBlocks := endBlock - startBlock + 1
+
+	rangeCount := totalBlocks / blockRange
+
+	if totalBlocks%blockRange != 0 {
+		rangeCount++
+	}
+
+	log.Printf("Total blocks to scan: %d\n", totalBlocks)
+	log.Printf("Block range: %d\n", blockRange)
+	log.Printf("Workers: %d\n", config.Rpc.workerCount())
+	log.Printf("Decoder: %s\n", config.Scan.decoder())
+	log.Printf("Addresses: %d, topic filters: %d\n", len(filter.Address), len(filter.Topics))
+
+	baseName := fmt.Sprintf("logs_%d_to_%d", startBlock, endBlock)
+	filePath := fmt.Sprintf("%s/%s.jsonl", config.Scan.OutputDir, baseName)
+	checkpointPath := fmt.Sprintf("%s/%s.checkpoint.json", config.Scan.OutputDir, baseName)
+
+	checkpoint := newLogScanCheckpoint(config)
+
+	if resume {
+		loaded, err := LoadLogScanCheckpoint(checkpointPath)
+		if err != nil {
+			return err
+		}
+
+		if err := loaded.matches(config); err != nil {
+			return fmt.Errorf("cannot resume: %w", err)
+		}
+
+		checkpoint = loaded
+		log.Printf("Resuming from checkpoint %s: %d of %d ranges already done\n", checkpointPath, checkpoint.CompletedRanges, rangeCount)
+	}
+
+	writer, err := OpenJSONLWriter(filePath, checkpoint.OutputBytes)
+	if err != nil {
+		return fmt.Errorf("failed to open logs output: %w", err)
+	}
+
+	defer writer.Close()
+
+	// The state as of the last fully handled range. Only this state is saved,
+	// so that a range that failed half way is fetched again on resume.
+	completed := *checkpoint
+
+	saveCheckpoint := func() error {
+		if _, err := writer.Sync(); err != nil {
+			return fmt.Errorf("failed to save logs output: %w", err)
+		}
+
+		completed.UpdatedAt = time.Now().Unix()
+
+		return SaveCheckpoint(&completed, checkpointPath)
+	}
+
+	if err := saveCheckpoint(); err != nil {
+		return err
+	}
+
+	client, err := NewRpcPool(config.Rpc)
+
+	if err != nil {
+		return fmt.Errorf("failed to create RPC client: %w", err)
+	}
+
+	defer client.Close()
+
+	log.Printf("Connected to RPC servers: %s\n", strings.Join(client.Urls(), ", "))
+	log.Printf("Rate limit: %s\n", client.Limiter())
+
+	bar := progressbar.NewOptions64(int64(rangeCount),
+		progressbar.OptionSetDescription("Fetching logs..."),
+		progressbar.OptionSetWriter(log.Writer()),
+		progressbar.OptionSetWidth(20),
+	)
+
+	bar.Set64(int64(checkpoint.CompletedRanges))
+
+	convertLogs := func(raw json.RawMessage) ([]Log, error) {
+		var rpcLogs []RpcLog
+		if err := json.Unmarshal(raw, &rpcLogs); err != nil {
+			return nil, fmt.Errorf("logs: %w", err)
+		}
+
+		return RpcLogsToLogs(rpcLogs)
+	}
+
+	if config.Scan.decoder() == DecoderNative {
+		convertLogs = NativeLogsToLogs
+	}
+
+	// Ranges are numbered from the first range not done yet
+	firstRange := checkpoint.CompletedRanges
+
+	rangeBounds := func(i int) (uint64, uint64) {
+		rangeStart := startBlock + (firstRange+uint64(i))*blockRange
+		rangeEnd := rangeStart + blockRange - 1
+
+		if rangeEnd > endBlock {
+			rangeEnd = endBlock
+		}
+
+		return rangeStart, rangeEnd
+	}
+
+	fetchRange := func(i int) *LogRangeResult {
+		rangeStart, rangeEnd := rangeBounds(i)
+
+		result := &LogRangeResult{Failures: make([]FailedRequest, 0)}
+		GetLogsRange(client, filter, rangeStart, rangeEnd, config.Rpc.Retry, result)
+
+		return result
+	}
+
+	checkpointInterval := config.Scan.BlockScanConfig.checkpointInterval()
+
+	handleRange := func(i int, result *LogRangeResult) error {
+		rangeStart, rangeEnd := rangeBounds(i)
+
+		checkpoint.Failures = append(checkpoint.Failures, result.Failures...)
+		checkpoint.Requests += result.Requests
+		checkpoint.Splits += result.Splits
+
+		for _, raw := range result.Responses {
+			logs, err := convertLogs(raw)
+
+			if err != nil {
+				return fmt.Errorf("failed to convert logs of blocks %d to %d: %w", rangeStart, rangeEnd, err)
+			}
+
+			for _, logData := range logs {
+				if err := writer.Write(logData); err != nil {
+					return fmt.Errorf("failed to save log: %w", err)
+				}
+			}
+
+			checkpoint.LogCount += uint64(len(logs))
+		}
+
+		checkpoint.CompletedRanges++
+		checkpoint.OutputBytes = writer.Offset()
+		completed = *checkpoint
+
+		if checkpoint.CompletedRanges%checkpointInterval == 0 {
+			if err := saveCheckpoint(); err != nil {
+				return err
+			}
+		}
+
+		bar.Describe(fmt.Sprintf("Logs: %d, Requests: %d, Splits: %d, Fail (Range): %d", checkpoint.LogCount, checkpoint.Requests, checkpoint.Splits, len(checkpoint.Failures)))
+		bar.Add(1)
+
+		return nil
+	}
+
+	if err := RunBatches(int(rangeCount-firstRange), config.Rpc.workerCount(), fetchRange, handleRange); err != nil {
+		if checkpointErr := saveCheckpoint(); checkpointErr != nil {
+			log.Printf("failed to save checkpoint: %v", checkpointErr)
+		}
+		return err
+	}
+
+	if err := saveCheckpoint(); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to close logs output: %w", err)
+	}
+
+	failuresPath := fmt.Sprintf("%s/failed_logs_%d_to_%d.json", config.Scan.OutputDir, startBlock, endBlock)
+
+	if err := SaveFailedRequests(checkpoint.Failures, failuresPath); err != nil {
+		return err
+	}
+
+	// The output is complete, the checkpoint is no longer needed
+	os.Remove(checkpointPath)
+
+	bar.Finish()
+
+	log.Printf("\nTask completed successfully!\n")
+	log.Printf("%d logs fetched with %d requests (%d range splits) and saved to %s.\n", checkpoint.LogCount, checkpoint.Requests, checkpoint.Splits, filePath)
+
+	if len(checkpoint.Failures) > 0 {
+		return fmt.Errorf("output %s is incomplete: %d block ranges failed, see %s", filePath, len(checkpoint.Failures), failuresPath)
+	}
+
+	return nil
+}
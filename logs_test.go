@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testLogService answers eth_getLogs with one log per block and rejects the
+// ranges a provider would reject.
+type testLogService struct {
+	mu       sync.Mutex
+	maxRange uint64          // Largest accepted block range
+	tooMany  map[uint64]bool // Blocks with too many logs to be returned at all
+	broken   map[uint64]bool // Blocks the node fails on for another reason
+}
+
+func (s *testLogService) BlockNumber() hexutil.Uint64 {
+	return 1_000_000
+}
+
+func (s *testLogService) GetLogs(filter LogFilter) ([]RpcLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, err := hexutil.DecodeUint64(filter.FromBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := hexutil.DecodeUint64(filter.ToBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]RpcLog, 0)
+
+	for number := from; number <= to; number++ {
+		if s.broken[number] {
+			return nil, errors.New("header not found")
+		}
+
+		if s.tooMany[number] || to-from+1 > s.maxRange {
+			return nil, errors.New("query returned more than 10000 results")
+		}
+
+		logs = append(logs, RpcLog{BlockNumber: hexutil.EncodeUint64(number)})
+	}
+
+	return logs, nil
+}
+
+func TestGetLogsRange(t *testing.T) {
+	tests := []struct {
+		name         string
+		service      *testLogService
+		from         uint64
+		to           uint64
+		wantBlocks   []uint64 // Blocks of the returned logs, in order
+		wantRequests uint64
+		wantSplits   uint64
+		wantFailures int
+	}{
+		{
+			name:         "accepted range",
+			service:      &testLogService{maxRange: 8},
+			from:         1,
+			to:           8,
+			wantBlocks:   []uint64{1, 2, 3, 4, 5, 6, 7, 8},
+			wantRequests: 1,
+		},
+		{
+			name:         "bisection",
+			service:      &testLogService{maxRange: 2},
+			from:         1,
+			to:           8,
+			wantBlocks:   []uint64{1, 2, 3, 4, 5, 6, 7, 8},
+			wantRequests: 7,
+			wantSplits:   3,
+		},
+		{
+			name:         "uneven bisection",
+			service:      &testLogService{maxRange: 2},
+			from:         11,
+			to:           15,
+			wantBlocks:   []uint64{11, 12, 13, 14, 15},
+			wantRequests: 5,
+			wantSplits:   2,
+		},
+		{
+			name:         "single block rejected",
+			service:      &testLogService{maxRange: 4, tooMany: map[uint64]bool{3: true}},
+			from:         1,
+			to:           4,
+			wantBlocks:   []uint64{1, 2, 4},
+			wantRequests: 5,
+			wantSplits:   2,
+			wantFailures: 1,
+		},
+		{
+			name:         "other errors are not split",
+			service:      &testLogService{maxRange: 4, broken: map[uint64]bool{2: true}},
+			from:         1,
+			to:           4,
+			wantBlocks:   []uint64{},
+			wantRequests: 1,
+			wantFailures: 1,
+		},
+	}
+
+	for _, test := range tests {
+		server := rpc.NewServer()
+		if err := server.RegisterName("eth", test.service); err != nil {
+			t.Fatal(err)
+		}
+
+		httpServer := httptest.NewServer(server)
+
+		client, err := NewRpcPool(RpcConfig{Url: httpServer.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := new(LogRangeResult)
+		retry := RetryConfig{MaxAttempts: 2, InitialBackoff: 1, MaxBackoff: 1}
+
+		GetLogsRange(client, LogFilter{}, test.from, test.to, retry, result)
+
+		client.Close()
+		httpServer.Close()
+		server.Stop()
+
+		blocks := make([]uint64, 0)
+
+		for _, response := range result.Responses {
+			var logs []RpcLog
+			if err := json.Unmarshal(response, &logs); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+
+			for _, log := range logs {
+				blocks = append(blocks, hexutil.MustDecodeUint64(log.BlockNumber))
+			}
+		}
+
+		if !slices.Equal(blocks, test.wantBlocks) {
+			t.Errorf("%s: logs of blocks %v, want %v", test.name, blocks, test.wantBlocks)
+		}
+
+		got := fmt.Sprintf("%d requests, %d splits, %d failures", result.Requests, result.Splits, len(result.Failures))
+		want := fmt.Sprintf("%d requests, %d splits, %d failures", test.wantRequests, test.wantSplits, test.wantFailures)
+
+		if got != want {
+			t.Errorf("%s: %s, want %s", test.name, got, want)
+		}
+	}
+}
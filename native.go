@@ -0,0 +1,631 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+const (
+	DecoderRpc    = "rpc"    // The RPC response structs of this module, decoded field by field
+	DecoderNative = "native" // The go-ethereum types, with transaction hashes recomputed from the decoded data
+)
+
+// decoder returns the configured decoder, falling back to the RPC response structs.
+func (s ScanConfig) decoder() string {
+	if s.Decoder == "" {
+		return DefaultDecoder
+	}
+
+	return s.Decoder
+}
+
+// nativeBlockBody holds the fields of a block response that are not part of the header.
+type nativeBlockBody struct {
+	Hash            common.Hash         `json:"hash"`
+	Size            *hexutil.Big        `json:"size"`
+	TotalDifficulty *hexutil.Big        `json:"totalDifficulty"`
+	Uncles          []common.Hash       `json:"uncles"`
+	Transactions    []json.RawMessage   `json:"transactions"`
+	Withdrawals     []*types.Withdrawal `json:"withdrawals"`
+}
+
+// nativeTransactionInfo holds the fields of a transaction response that are
+// not part of the signed transaction.
+type nativeTransactionInfo struct {
+	BlockHash        common.Hash    `json:"blockHash"`
+	BlockNumber      *hexutil.Big   `json:"blockNumber"`
+	From             common.Address `json:"from"`
+	Hash             common.Hash    `json:"hash"`
+	TransactionIndex hexutil.Uint64 `json:"transactionIndex"`
+}
+
+// nativeReceiptInfo holds the fields of a receipt response that are not part of the receipt.
+type nativeReceiptInfo struct {
+	From common.Address  `json:"from"`
+	To   *common.Address `json:"to"`
+}
+
+// NativeBlockToBlockFull decodes a full block response into go-ethereum types
+// and maps them into a BlockFull. The transaction hashes are recomputed and
+// must match the ones returned by the node. The block hash is kept as returned:
+// headers with fields unknown to go-ethereum, such as those of some L2 chains,
+// hash differently, so a mismatch is only reported when verify_blocks is set.
+func NativeBlockToBlockFull(raw json.RawMessage) (*BlockFull, error) {
+	var header types.Header
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, fmt.Errorf("block: %w", err)
+	}
+
+	var body nativeBlockBody
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, fmt.Errorf("block: %w", err)
+	}
+
+	transactions := make([]TransactionFull, len(body.Transactions))
+
+	for i, rawTx := range body.Transactions {
+		tx, err := nativeTransaction(rawTx, header.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("block.transactions[%d]: %w", i, err)
+		}
+
+		transactions[i] = *tx
+	}
+
+	var withdrawals []Withdrawal
+	if body.Withdrawals != nil {
+		withdrawals = make([]Withdrawal, len(body.Withdrawals))
+
+		for i, withdrawal := range body.Withdrawals {
+			withdrawals[i] = Withdrawal{
+				Index:          new(big.Int).SetUint64(withdrawal.Index),
+				ValidatorIndex: new(big.Int).SetUint64(withdrawal.Validator),
+				Address:        addressToString(withdrawal.Address),
+				Amount:         new(big.Int).SetUint64(withdrawal.Amount),
+			}
+		}
+	}
+
+	var uncles []string
+	if body.Uncles != nil {
+		uncles = make([]string, len(body.Uncles))
+
+		for i, uncle := range body.Uncles {
+			uncles[i] = uncle.Hex()
+		}
+	}
+
+	return &BlockFull{
+		Difficulty:            header.Difficulty,
+		ExtraData:             hexutil.Encode(header.Extra),
+		GasLimit:              new(big.Int).SetUint64(header.GasLimit),
+		GasUsed:               new(big.Int).SetUint64(header.GasUsed),
+		Hash:                  body.Hash.Hex(),
+		LogsBloom:             hexutil.Encode(header.Bloom[:]),
+		Miner:                 addressToString(header.Coinbase),
+		MixHash:               header.MixDigest.Hex(),
+		Nonce:                 new(big.Int).SetUint64(header.Nonce.Uint64()),
+		Number:                header.Number,
+		ParentHash:            header.ParentHash.Hex(),
+		ReceiptsRoot:          header.ReceiptHash.Hex(),
+		Sha3Uncles:            header.UncleHash.Hex(),
+		Size:                  (*big.Int)(body.Size),
+		StateRoot:             header.Root.Hex(),
+		Timestamp:             new(big.Int).SetUint64(header.Time),
+		TotalDifficulty:       (*big.Int)(body.TotalDifficulty),
+		TransactionsRoot:      header.TxHash.Hex(),
+		Uncles:                uncles,
+		BaseFeePerGas:         header.BaseFee,
+		BlobGasUsed:           optionalUint64ToBigInt(header.BlobGasUsed),
+		ExcessBlobGas:         optionalUint64ToBigInt(header.ExcessBlobGas),
+		ParentBeaconBlockRoot: optionalHashToString(header.ParentBeaconRoot),
+		WithdrawalsRoot:       optionalHashToString(header.WithdrawalsHash),
+		RequestsHash:          optionalHashToString(header.RequestsHash),
+		Withdrawals:           withdrawals,
+		Transactions:          transactions,
+	}, nil
+}
+
+// nativeTransaction decodes a transaction of a full block. The base fee of
+// the block is needed for the gas price paid by dynamic fee transactions.
+func nativeTransaction(raw json.RawMessage, baseFee *big.Int) (*TransactionFull, error) {
+	var tx types.Transaction
+	if err := json.Unmarshal(raw, &tx); err != nil {
+		return nil, err
+	}
+
+	var info nativeTransactionInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, err
+	}
+
+	hash := tx.Hash()
+	if hash != info.Hash {
+		return nil, fmt.Errorf("computed hash %s does not match %s", hash.Hex(), info.Hash.Hex())
+	}
+
+	v, r, s := tx.RawSignatureValues()
+
+	transaction := &TransactionFull{
+		BlockHash:        info.BlockHash.Hex(),
+		BlockNumber:      (*big.Int)(info.BlockNumber),
+		From:             addressToString(info.From),
+		Gas:              new(big.Int).SetUint64(tx.Gas()),
+		GasPrice:         tx.GasPrice(),
+		Hash:             hash.Hex(),
+		Input:            hexutil.Encode(tx.Data()),
+		Nonce:            new(big.Int).SetUint64(tx.Nonce()),
+		TransactionIndex: new(big.Int).SetUint64(uint64(info.TransactionIndex)),
+		Value:            tx.Value(),
+		Type:             big.NewInt(int64(tx.Type())),
+		V:                hexutil.EncodeBig(v),
+		R:                hexutil.EncodeBig(r),
+		S:                hexutil.EncodeBig(s),
+	}
+
+	if tx.To() != nil {
+		transaction.To = addressToString(*tx.To())
+	}
+
+	// Legacy transactions only carry a chain ID when they are replay protected (EIP-155).
+	if tx.Type() != types.LegacyTxType || tx.Protected() {
+		transaction.ChainId = tx.ChainId()
+	}
+
+	if tx.Type() != types.LegacyTxType {
+		transaction.YParity = hexutil.EncodeBig(v)
+
+		transaction.AccessList = make([]AccessTuple, len(tx.AccessList()))
+
+		for i, tuple := range tx.AccessList() {
+			storageKeys := make([]string, len(tuple.StorageKeys))
+			for j, key := range tuple.StorageKeys {
+				storageKeys[j] = key.Hex()
+			}
+
+			transaction.AccessList[i] = AccessTuple{Address: addressToString(tuple.Address), StorageKeys: storageKeys}
+		}
+	}
+
+	if tx.Type() >= types.DynamicFeeTxType {
+		transaction.MaxFeePerGas = tx.GasFeeCap()
+		transaction.MaxPriorityFeePerGas = tx.GasTipCap()
+
+		// The gas price of an included dynamic fee transaction is the price it paid.
+		if baseFee != nil {
+			transaction.GasPrice = tx.EffectiveGasTipValue(baseFee)
+			transaction.GasPrice.Add(transaction.GasPrice, baseFee)
+		}
+	}
+
+	if tx.Type() == types.BlobTxType {
+		transaction.MaxFeePerBlobGas = tx.BlobGasFeeCap()
+
+		transaction.BlobVersionedHashes = make([]string, len(tx.BlobHashes()))
+		for i, blobHash := range tx.BlobHashes() {
+			transaction.BlobVersionedHashes[i] = blobHash.Hex()
+		}
+	}
+
+	if tx.Type() == types.SetCodeTxType {
+		transaction.AuthorizationList = make([]Authorization, len(tx.SetCodeAuthorizations()))
+
+		for i, authorization := range tx.SetCodeAuthorizations() {
+			transaction.AuthorizationList[i] = Authorization{
+				ChainId: authorization.ChainID.ToBig(),
+				Address: addressToString(authorization.Address),
+				Nonce:   new(big.Int).SetUint64(authorization.Nonce),
+				YParity: hexutil.EncodeUint64(uint64(authorization.V)),
+				R:       hexutil.EncodeBig(authorization.R.ToBig()),
+				S:       hexutil.EncodeBig(authorization.S.ToBig()),
+			}
+
+			if authority, err := authorization.Authority(); err == nil {
+				transaction.AuthorizationList[i].Authority = addressToString(authority)
+			}
+		}
+	}
+
+	return transaction, nil
+}
+
+// NativeReceiptToReceipt decodes a receipt response into a go-ethereum receipt
+// and maps it into a Receipt.
+func NativeReceiptToReceipt(raw json.RawMessage) (*Receipt, error) {
+	var receipt types.Receipt
+	if err := json.Unmarshal(raw, &receipt); err != nil {
+		return nil, fmt.Errorf("receipt: %w", err)
+	}
+
+	var info nativeReceiptInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, fmt.Errorf("receipt: %w", err)
+	}
+
+	logs := make([]Log, len(receipt.Logs))
+
+	for i, log := range receipt.Logs {
+		logs[i] = nativeLog(log)
+	}
+
+	result := &Receipt{
+		BlockHash:         receipt.BlockHash.Hex(),
+		BlockNumber:       receipt.BlockNumber,
+		CumulativeGasUsed: new(big.Int).SetUint64(receipt.CumulativeGasUsed),
+		GasUsed:           new(big.Int).SetUint64(receipt.GasUsed),
+		TransactionHash:   receipt.TxHash.Hex(),
+		TransactionIndex:  new(big.Int).SetUint64(uint64(receipt.TransactionIndex)),
+		Logs:              logs,
+		LogsBloom:         hexutil.Encode(receipt.Bloom[:]),
+		From:              addressToString(info.From),
+		EffectiveGasPrice: receipt.EffectiveGasPrice,
+		Type:              big.NewInt(int64(receipt.Type)),
+		BlobGasPrice:      receipt.BlobGasPrice,
+	}
+
+	// Receipts from before Byzantium have a state root instead of a status.
+	if len(receipt.PostState) == 0 {
+		result.Status = hexutil.EncodeUint64(receipt.Status)
+	} else {
+		result.Root = hexutil.Encode(receipt.PostState)
+	}
+
+	if receipt.ContractAddress != (common.Address{}) {
+		result.ContractAddress = addressToString(receipt.ContractAddress)
+	}
+
+	if info.To != nil {
+		result.To = addressToString(*info.To)
+	}
+
+	if receipt.Type == types.BlobTxType {
+		result.BlobGasUsed = new(big.Int).SetUint64(receipt.BlobGasUsed)
+	}
+
+	return result, nil
+}
+
+// NativeLogsToLogs decodes an eth_getLogs response into go-ethereum logs and maps them into Logs.
+func NativeLogsToLogs(raw json.RawMessage) ([]Log, error) {
+	var nativeLogs []*types.Log
+	if err := json.Unmarshal(raw, &nativeLogs); err != nil {
+		return nil, fmt.Errorf("logs: %w", err)
+	}
+
+	logs := make([]Log, len(nativeLogs))
+
+	for i, log := range nativeLogs {
+		logs[i] = nativeLog(log)
+	}
+
+	return logs, nil
+}
+
+func nativeLog(log *types.Log) Log {
+	topics := make([]string, len(log.Topics))
+	for j, topic := range log.Topics {
+		topics[j] = topic.Hex()
+	}
+
+	return Log{
+		Address:          addressToString(log.Address),
+		Topics:           topics,
+		Data:             hexutil.Encode(log.Data),
+		BlockNumber:      new(big.Int).SetUint64(log.BlockNumber),
+		TransactionHash:  log.TxHash.Hex(),
+		TransactionIndex: new(big.Int).SetUint64(uint64(log.TxIndex)),
+		BlockHash:        log.BlockHash.Hex(),
+		LogIndex:         new(big.Int).SetUint64(uint64(log.Index)),
+		Removed:          log.Removed,
+	}
+}
+
+// TransactionFullToNative rebuilds the signed go-ethereum transaction of a
+// scanned transaction, so that its hash and sender can be recomputed.
+func TransactionFullToNative(tx *TransactionFull) (*types.Transaction, error) {
+	if tx.Nonce == nil || tx.Gas == nil || tx.Value == nil {
+		return nil, fmt.Errorf("transaction is missing its nonce, gas or value")
+	}
+
+	if !tx.Nonce.IsUint64() || !tx.Gas.IsUint64() {
+		return nil, fmt.Errorf("nonce or gas does not fit in 64 bits")
+	}
+
+	data, err := hexutil.Decode(tx.Input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+
+	v, err := parseHexQuantity(tx.V)
+	if err != nil {
+		return nil, fmt.Errorf("invalid v: %w", err)
+	}
+
+	r, err := parseHexQuantity(tx.R)
+	if err != nil {
+		return nil, fmt.Errorf("invalid r: %w", err)
+	}
+
+	s, err := parseHexQuantity(tx.S)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s: %w", err)
+	}
+
+	var to *common.Address
+	if tx.To != "" {
+		address := common.HexToAddress(tx.To)
+		to = &address
+	}
+
+	accessList := make(types.AccessList, len(tx.AccessList))
+	for i, tuple := range tx.AccessList {
+		accessList[i].Address = common.HexToAddress(tuple.Address)
+		accessList[i].StorageKeys = make([]common.Hash, len(tuple.StorageKeys))
+
+		for j, key := range tuple.StorageKeys {
+			accessList[i].StorageKeys[j] = common.HexToHash(key)
+		}
+	}
+
+	txType := uint64(types.LegacyTxType)
+	if tx.Type != nil {
+		txType = tx.Type.Uint64()
+	}
+
+	switch txType {
+	case types.LegacyTxType:
+		return types.NewTx(&types.LegacyTx{
+			Nonce: tx.Nonce.Uint64(), GasPrice: tx.GasPrice, Gas: tx.Gas.Uint64(), To: to, Value: tx.Value, Data: data,
+			V: v, R: r, S: s,
+		}), nil
+	case types.AccessListTxType:
+		return types.NewTx(&types.AccessListTx{
+			ChainID: tx.ChainId, Nonce: tx.Nonce.Uint64(), GasPrice: tx.GasPrice, Gas: tx.Gas.Uint64(), To: to, Value: tx.Value, Data: data,
+			AccessList: accessList, V: v, R: r, S: s,
+		}), nil
+	case types.DynamicFeeTxType:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID: tx.ChainId, Nonce: tx.Nonce.Uint64(), GasTipCap: tx.MaxPriorityFeePerGas, GasFeeCap: tx.MaxFeePerGas, Gas: tx.Gas.Uint64(),
+			To: to, Value: tx.Value, Data: data, AccessList: accessList, V: v, R: r, S: s,
+		}), nil
+	}
+
+	// Blob and set-code transactions use 256-bit integers and always have a recipient.
+	if to == nil {
+		return nil, fmt.Errorf("transaction of type %d has no recipient", txType)
+	}
+
+	values, err := toUint256s(map[string]*big.Int{
+		"chainId": tx.ChainId, "maxPriorityFeePerGas": tx.MaxPriorityFeePerGas, "maxFeePerGas": tx.MaxFeePerGas,
+		"value": tx.Value, "maxFeePerBlobGas": tx.MaxFeePerBlobGas, "v": v, "r": r, "s": s,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch txType {
+	case types.BlobTxType:
+		blobHashes := make([]common.Hash, len(tx.BlobVersionedHashes))
+		for i, blobHash := range tx.BlobVersionedHashes {
+			blobHashes[i] = common.HexToHash(blobHash)
+		}
+
+		return types.NewTx(&types.BlobTx{
+			ChainID: values["chainId"], Nonce: tx.Nonce.Uint64(), GasTipCap: values["maxPriorityFeePerGas"], GasFeeCap: values["maxFeePerGas"],
+			Gas: tx.Gas.Uint64(), To: *to, Value: values["value"], Data: data, AccessList: accessList,
+			BlobFeeCap: values["maxFeePerBlobGas"], BlobHashes: blobHashes, V: values["v"], R: values["r"], S: values["s"],
+		}), nil
+	case types.SetCodeTxType:
+		authorizations := make([]types.SetCodeAuthorization, len(tx.AuthorizationList))
+
+		for i, authorization := range tx.AuthorizationList {
+			if authorization.Nonce == nil || !authorization.Nonce.IsUint64() {
+				return nil, fmt.Errorf("authorization %d has an invalid nonce", i)
+			}
+
+			yParity, err := parseHexQuantity(authorization.YParity)
+			if err != nil || yParity.Cmp(big.NewInt(255)) > 0 {
+				return nil, fmt.Errorf("authorization %d has an invalid yParity %q", i, authorization.YParity)
+			}
+
+			chainId, err := toUint256s(map[string]*big.Int{"chainId": authorization.ChainId})
+			if err != nil {
+				return nil, fmt.Errorf("authorization %d: %w", i, err)
+			}
+
+			r, err := parseHexQuantity(authorization.R)
+			if err != nil {
+				return nil, fmt.Errorf("authorization %d: invalid r: %w", i, err)
+			}
+
+			s, err := parseHexQuantity(authorization.S)
+			if err != nil {
+				return nil, fmt.Errorf("authorization %d: invalid s: %w", i, err)
+			}
+
+			// parseHexQuantity rejects values larger than 256 bits.
+			authorizations[i] = types.SetCodeAuthorization{
+				ChainID: *chainId["chainId"],
+				Address: common.HexToAddress(authorization.Address),
+				Nonce:   authorization.Nonce.Uint64(),
+				V:       uint8(yParity.Uint64()),
+				R:       *uint256.MustFromBig(r),
+				S:       *uint256.MustFromBig(s),
+			}
+		}
+
+		return types.NewTx(&types.SetCodeTx{
+			ChainID: values["chainId"], Nonce: tx.Nonce.Uint64(), GasTipCap: values["maxPriorityFeePerGas"], GasFeeCap: values["maxFeePerGas"],
+			Gas: tx.Gas.Uint64(), To: *to, Value: values["value"], Data: data, AccessList: accessList,
+			AuthList: authorizations, V: values["v"], R: values["r"], S: values["s"],
+		}), nil
+	}
+
+	return nil, fmt.Errorf("transaction type %d is not supported", txType)
+}
+
+// toUint256s converts the named values to 256-bit integers. Missing values
+// (e.g. the blob fee cap of a set-code transaction) are converted to zero.
+func toUint256s(values map[string]*big.Int) (map[string]*uint256.Int, error) {
+	result := make(map[string]*uint256.Int, len(values))
+
+	for name, value := range values {
+		if value == nil {
+			result[name] = new(uint256.Int)
+			continue
+		}
+
+		converted, overflow := uint256.FromBig(value)
+		if overflow {
+			return nil, fmt.Errorf("%s does not fit in 256 bits", name)
+		}
+
+		result[name] = converted
+	}
+
+	return result, nil
+}
+
+// BlockFullToHeader rebuilds the go-ethereum header of a scanned block, so
+// that its hash can be recomputed.
+func BlockFullToHeader(block *BlockFull) (*types.Header, error) {
+	if block.Number == nil || block.Difficulty == nil || block.GasLimit == nil || block.GasUsed == nil || block.Timestamp == nil {
+		return nil, fmt.Errorf("block is missing its number, difficulty, gas limit, gas used or timestamp")
+	}
+
+	extra, err := hexutil.Decode(block.ExtraData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extra data: %w", err)
+	}
+
+	bloom, err := hexutil.Decode(block.LogsBloom)
+	if err != nil || len(bloom) != types.BloomByteLength {
+		return nil, fmt.Errorf("invalid logs bloom")
+	}
+
+	nonce := uint64(0)
+	if block.Nonce != nil {
+		nonce = block.Nonce.Uint64()
+	}
+
+	return &types.Header{
+		ParentHash:       common.HexToHash(block.ParentHash),
+		UncleHash:        common.HexToHash(block.Sha3Uncles),
+		Coinbase:         common.HexToAddress(block.Miner),
+		Root:             common.HexToHash(block.StateRoot),
+		TxHash:           common.HexToHash(block.TransactionsRoot),
+		ReceiptHash:      common.HexToHash(block.ReceiptsRoot),
+		Bloom:            types.BytesToBloom(bloom),
+		Difficulty:       block.Difficulty,
+		Number:           block.Number,
+		GasLimit:         block.GasLimit.Uint64(),
+		GasUsed:          block.GasUsed.Uint64(),
+		Time:             block.Timestamp.Uint64(),
+		Extra:            extra,
+		MixDigest:        common.HexToHash(block.MixHash),
+		Nonce:            types.EncodeNonce(nonce),
+		BaseFee:          block.BaseFeePerGas,
+		WithdrawalsHash:  optionalStringToHash(block.WithdrawalsRoot),
+		BlobGasUsed:      optionalBigIntToUint64(block.BlobGasUsed),
+		ExcessBlobGas:    optionalBigIntToUint64(block.ExcessBlobGas),
+		ParentBeaconRoot: optionalStringToHash(block.ParentBeaconBlockRoot),
+		RequestsHash:     optionalStringToHash(block.RequestsHash),
+	}, nil
+}
+
+// ReceiptToNative rebuilds the consensus fields of a scanned receipt, which
+// are the ones stored in the receipts trie.
+func ReceiptToNative(receipt *Receipt) (*types.Receipt, error) {
+	if receipt.CumulativeGasUsed == nil || !receipt.CumulativeGasUsed.IsUint64() {
+		return nil, fmt.Errorf("receipt %s has an invalid cumulative gas used", receipt.TransactionHash)
+	}
+
+	bloom, err := hexutil.Decode(receipt.LogsBloom)
+	if err != nil || len(bloom) != types.BloomByteLength {
+		return nil, fmt.Errorf("receipt %s has an invalid logs bloom", receipt.TransactionHash)
+	}
+
+	result := &types.Receipt{
+		CumulativeGasUsed: receipt.CumulativeGasUsed.Uint64(),
+		Bloom:             types.BytesToBloom(bloom),
+		Logs:              make([]*types.Log, len(receipt.Logs)),
+	}
+
+	if receipt.Type != nil {
+		result.Type = uint8(receipt.Type.Uint64())
+	}
+
+	// Receipts from before Byzantium have a state root instead of a status.
+	if receipt.Root != "" {
+		result.PostState = common.HexToHash(receipt.Root).Bytes()
+	} else {
+		status, err := parseHexQuantity(receipt.Status)
+		if err != nil {
+			return nil, fmt.Errorf("receipt %s has an invalid status: %w", receipt.TransactionHash, err)
+		}
+
+		result.Status = status.Uint64()
+	}
+
+	for i, log := range receipt.Logs {
+		data, err := hexutil.Decode(log.Data)
+		if err != nil {
+			return nil, fmt.Errorf("receipt %s has invalid data in log %d: %w", receipt.TransactionHash, i, err)
+		}
+
+		topics := make([]common.Hash, len(log.Topics))
+		for j, topic := range log.Topics {
+			topics[j] = common.HexToHash(topic)
+		}
+
+		result.Logs[i] = &types.Log{Address: common.HexToAddress(log.Address), Topics: topics, Data: data}
+	}
+
+	return result, nil
+}
+
+func optionalStringToHash(value string) *common.Hash {
+	if value == "" {
+		return nil
+	}
+
+	hash := common.HexToHash(value)
+	return &hash
+}
+
+func optionalBigIntToUint64(value *big.Int) *uint64 {
+	if value == nil {
+		return nil
+	}
+
+	result := value.Uint64()
+	return &result
+}
+
+// addressToString returns the address in lower case, the way nodes return it.
+func addressToString(address common.Address) string {
+	return strings.ToLower(address.Hex())
+}
+
+func optionalHashToString(hash *common.Hash) string {
+	if hash == nil {
+		return ""
+	}
+
+	return hash.Hex()
+}
+
+func optionalUint64ToBigInt(value *uint64) *big.Int {
+	if value == nil {
+		return nil
+	}
+
+	return new(big.Int).SetUint64(*value)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestNativeBlockToBlockFullHash(t *testing.T) {
+	header := &types.Header{
+		ParentHash:  common.HexToHash("0x01"),
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    common.HexToAddress("0x02"),
+		Root:        common.HexToHash("0x03"),
+		TxHash:      types.EmptyTxsHash,
+		ReceiptHash: types.EmptyReceiptsHash,
+		Difficulty:  big.NewInt(0),
+		Number:      big.NewInt(100),
+		GasLimit:    30_000_000,
+		Time:        1_700_000_000,
+		BaseFee:     big.NewInt(1_000_000_000),
+	}
+
+	otherHash := "0x" + strings.Repeat("ee", 32)
+
+	tests := []struct {
+		name         string
+		hash         string // Hash returned by the node, the computed hash when empty
+		wantMismatch bool
+	}{
+		{name: "matching hash"},
+		// e.g. an L2 header with fields go-ethereum does not know about
+		{name: "other hash", hash: otherHash, wantMismatch: true},
+	}
+
+	for _, test := range tests {
+		fields := make(map[string]any)
+
+		encoded, err := json.Marshal(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := json.Unmarshal(encoded, &fields); err != nil {
+			t.Fatal(err)
+		}
+
+		fields["transactions"] = []any{}
+		fields["uncles"] = []any{}
+		if test.hash != "" {
+			fields["hash"] = test.hash
+		}
+
+		raw, err := json.Marshal(fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		block, err := NativeBlockToBlockFull(raw)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		wantHash := header.Hash().Hex()
+		if test.hash != "" {
+			wantHash = test.hash
+		}
+
+		if block.Hash != wantHash {
+			t.Errorf("%s: block hash %s, want the hash returned by the node %s", test.name, block.Hash, wantHash)
+		}
+
+		mismatches := VerifyBlock(block, nil)
+
+		if mismatch := len(mismatches) > 0; mismatch != test.wantMismatch {
+			t.Errorf("%s: mismatches %+v, want a hash mismatch %t", test.name, mismatches, test.wantMismatch)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	StrategyRoundRobin   = "round_robin"   // Weighted round-robin over healthy endpoints
+	StrategyLeastLatency = "least_latency" // Healthy endpoint with the lowest observed latency
+
+	healthCheckTimeout = 10 * time.Second
+	latencySmoothing   = 0.2 // Weight of the newest sample in the latency moving average
+)
+
+// rpcEndpoint is a single RPC server of the pool and its observed health.
+type rpcEndpoint struct {
+	url           string
+	weight        int64
+	currentWeight int64 // Smooth weighted round-robin state
+	client        *rpc.Client
+	healthy       bool
+	latency       time.Duration // Moving average of successful request latencies
+	head          uint64        // Last chain head reported by the health check
+	lastErr       error
+}
+
+// RpcPool dispatches requests over several RPC endpoints, with health checks,
+// weighted round-robin or least-latency selection and automatic failover.
+type RpcPool struct {
+	mu          sync.Mutex
+	endpoints   []*rpcEndpoint
+	strategy    string
+	maxBlockLag uint64
+	limiter     *RateLimiter
+	timeout     time.Duration
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// endpointConfigs returns the configured endpoints, falling back to the single Url.
+func (r RpcConfig) endpointConfigs() []EndpointConfig {
+	if len(r.Endpoints) > 0 {
+		return r.Endpoints
+	}
+
+	return []EndpointConfig{{Url: r.Url, Weight: 1}}
+}
+
+// NewRpcPool dials every configured endpoint and starts the periodic health checks.
+// Endpoints that cannot be dialed are kept and retried by the health checks.
+func NewRpcPool(config RpcConfig) (*RpcPool, error) {
+	strategy := config.Strategy
+	if strategy == "" {
+		strategy = DefaultPoolStrategy
+	}
+
+	if strategy != StrategyRoundRobin && strategy != StrategyLeastLatency {
+		return nil, fmt.Errorf("unknown endpoint selection strategy %q", strategy)
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = DefaultRequestTimeout
+	}
+
+	pool := &RpcPool{
+		strategy:    strategy,
+		maxBlockLag: config.MaxBlockLag,
+		limiter:     NewRateLimiter(config),
+		timeout:     time.Duration(config.Timeout) * time.Millisecond,
+		stop:        make(chan struct{}),
+	}
+
+	for _, endpointConfig := range config.endpointConfigs() {
+		if endpointConfig.Url == "" {
+			return nil, fmt.Errorf("endpoint url must not be empty")
+		}
+
+		weight := int64(endpointConfig.Weight)
+		if weight <= 0 {
+			weight = 1
+		}
+
+		endpoint := &rpcEndpoint{url: endpointConfig.Url, weight: weight}
+
+		client, err := GetRpcClient(endpoint.url)
+		if err != nil {
+			log.Printf("Endpoint %s unavailable: %v\n", endpoint.url, err)
+			endpoint.lastErr = err
+		} else {
+			endpoint.client = client
+			endpoint.healthy = true
+		}
+
+		pool.endpoints = append(pool.endpoints, endpoint)
+	}
+
+	pool.CheckHealth()
+
+	if pool.healthyCount() == 0 {
+		pool.Close()
+		return nil, fmt.Errorf("none of the %d RPC endpoints is reachable", len(pool.endpoints))
+	}
+
+	interval := config.HealthCheckInterval
+	if interval == 0 {
+		interval = DefaultHealthCheckInterval
+	}
+
+	go pool.healthLoop(time.Duration(interval) * time.Millisecond)
+
+	return pool, nil
+}
+
+// Close stops the health checks and closes every client.
+func (p *RpcPool) Close() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		for _, endpoint := range p.endpoints {
+			if endpoint.client != nil {
+				endpoint.client.Close()
+			}
+		}
+	})
+}
+
+// Limiter returns the rate limiter shared by all requests of the pool.
+func (p *RpcPool) Limiter() *RateLimiter {
+	return p.limiter
+}
+
+// Urls returns the urls of all endpoints of the pool.
+func (p *RpcPool) Urls() []string {
+	urls := make([]string, len(p.endpoints))
+	for i, endpoint := range p.endpoints {
+		urls[i] = endpoint.url
+	}
+
+	return urls
+}
+
+func (p *RpcPool) healthyCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	count := 0
+	for _, endpoint := range p.endpoints {
+		if endpoint.healthy {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (p *RpcPool) healthLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.CheckHealth()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// CheckHealth queries the chain head of every endpoint. Endpoints that error or
+// fall more than MaxBlockLag blocks behind the highest head are marked unhealthy.
+func (p *RpcPool) CheckHealth() {
+	type headResult struct {
+		head    uint64
+		latency time.Duration
+		client  *rpc.Client
+		err     error
+	}
+
+	p.mu.Lock()
+	endpoints := make([]*rpcEndpoint, len(p.endpoints))
+	copy(endpoints, p.endpoints)
+	clients := make([]*rpc.Client, len(endpoints))
+	for i, endpoint := range endpoints {
+		clients[i] = endpoint.client
+	}
+	p.mu.Unlock()
+
+	results := make([]headResult, len(endpoints))
+
+	var wg sync.WaitGroup
+
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+
+		go func(i int, url string, client *rpc.Client) {
+			defer wg.Done()
+
+			if client == nil {
+				dialed, err := GetRpcClient(url)
+				if err != nil {
+					results[i].err = err
+					return
+				}
+				client = dialed
+				results[i].client = dialed
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+			defer cancel()
+
+			var head hexutil.Uint64
+			start := time.Now()
+			err := client.CallContext(ctx, &head, "eth_blockNumber")
+
+			results[i].head = uint64(head)
+			results[i].latency = time.Since(start)
+			results[i].err = err
+		}(i, endpoint.url, clients[i])
+	}
+
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	maxHead := uint64(0)
+	for _, result := range results {
+		if result.err == nil && result.head > maxHead {
+			maxHead = result.head
+		}
+	}
+
+	for i, endpoint := range endpoints {
+		result := results[i]
+
+		if result.client != nil {
+			endpoint.client = result.client
+		}
+
+		wasHealthy := endpoint.healthy
+
+		switch {
+		case result.err != nil:
+			endpoint.healthy = false
+			endpoint.lastErr = result.err
+		case p.maxBlockLag > 0 && maxHead-result.head > p.maxBlockLag:
+			endpoint.healthy = false
+			endpoint.lastErr = fmt.Errorf("%d blocks behind the chain head", maxHead-result.head)
+		default:
+			endpoint.healthy = true
+			endpoint.lastErr = nil
+			endpoint.recordLatency(result.latency)
+		}
+
+		endpoint.head = result.head
+
+		if wasHealthy && !endpoint.healthy {
+			log.Printf("Endpoint %s marked unhealthy: %v\n", endpoint.url, endpoint.lastErr)
+		} else if !wasHealthy && endpoint.healthy {
+			log.Printf("Endpoint %s is healthy again (head %d)\n", endpoint.url, endpoint.head)
+		}
+	}
+}
+
+func (e *rpcEndpoint) recordLatency(latency time.Duration) {
+	if e.latency == 0 {
+		e.latency = latency
+		return
+	}
+
+	e.latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(e.latency))
+}
+
+// candidates returns the endpoints to try for the next request, in order.
+// The selected endpoint comes first, then the other healthy endpoints as
+// failover and finally the unhealthy ones as a last resort.
+func (p *RpcPool) candidates() []*rpcEndpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	healthy := make([]*rpcEndpoint, 0, len(p.endpoints))
+	unhealthy := make([]*rpcEndpoint, 0)
+
+	for _, endpoint := range p.endpoints {
+		if endpoint.client == nil {
+			continue
+		}
+
+		if endpoint.healthy {
+			healthy = append(healthy, endpoint)
+		} else {
+			unhealthy = append(unhealthy, endpoint)
+		}
+	}
+
+	switch p.strategy {
+	case StrategyLeastLatency:
+		sort.SliceStable(healthy, func(i, j int) bool {
+			return healthy[i].latency < healthy[j].latency
+		})
+	default:
+		if len(healthy) > 1 {
+			// Smooth weighted round-robin: the endpoint with the highest current
+			// weight is selected and pays back the total weight.
+			total := int64(0)
+			selected := 0
+
+			for i, endpoint := range healthy {
+				endpoint.currentWeight += endpoint.weight
+				total += endpoint.weight
+
+				if endpoint.currentWeight > healthy[selected].currentWeight {
+					selected = i
+				}
+			}
+
+			healthy[selected].currentWeight -= total
+
+			ordered := make([]*rpcEndpoint, 0, len(healthy))
+			ordered = append(ordered, healthy[selected:]...)
+			ordered = append(ordered, healthy[:selected]...)
+			healthy = ordered
+		}
+	}
+
+	return append(healthy, unhealthy...)
+}
+
+// markResult records the outcome of a request sent to the endpoint.
+// Only transport errors mark the endpoint unhealthy: JSON-RPC errors are
+// answers from a working server, HTTP 429 is throttling, which the rate
+// limiter handles, and timeouts or oversized requests are fixed by smaller batches.
+func (p *RpcPool) markResult(endpoint *rpcEndpoint, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var rpcErr rpc.Error
+	var httpErr rpc.HTTPError
+
+	switch {
+	case err == nil:
+		endpoint.recordLatency(latency)
+		if !endpoint.healthy {
+			log.Printf("Endpoint %s is healthy again\n", endpoint.url)
+		}
+		endpoint.healthy = true
+		endpoint.lastErr = nil
+	case errors.As(err, &rpcErr):
+		endpoint.recordLatency(latency)
+	case errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests:
+		// The endpoint is up, the rate limiter slows down instead.
+	case isBatchSizeError(err):
+		endpoint.recordLatency(latency)
+	default:
+		if endpoint.healthy {
+			log.Printf("Endpoint %s marked unhealthy: %v\n", endpoint.url, err)
+		}
+		endpoint.healthy = false
+		endpoint.lastErr = err
+	}
+}
+
+// recordThrottling adapts the rate limiter to the outcome of a request.
+func (p *RpcPool) recordThrottling(throttled bool) {
+	if throttled {
+		p.limiter.Throttled()
+	} else {
+		p.limiter.Succeeded()
+	}
+}
+
+// BatchCall sends the batch to the selected endpoint and fails over to the
+// next endpoint when the whole batch fails. A batch that was too large or too
+// slow is returned to the caller, which retries it in smaller batches. Every
+// attempt goes through the rate limiter.
+func (p *RpcPool) BatchCall(batch []rpc.BatchElem) error {
+	candidates := p.candidates()
+	if len(candidates) == 0 {
+		return fmt.Errorf("no RPC endpoint available")
+	}
+
+	var err error
+
+	for _, endpoint := range candidates {
+		for i := range batch {
+			batch[i].Error = nil
+		}
+
+		p.limiter.Wait(len(batch))
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		start := time.Now()
+		err = endpoint.client.BatchCallContext(ctx, batch)
+		cancel()
+		p.markResult(endpoint, time.Since(start), err)
+
+		throttled := isThrottleError(err)
+		for i := range batch {
+			throttled = throttled || isThrottleError(batch[i].Error)
+		}
+
+		p.recordThrottling(throttled)
+
+		if err == nil || isBatchSizeError(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// Call sends the request to the selected endpoint and fails over to the next
+// endpoint when it errors. JSON-RPC errors are answers to the request itself,
+// and timeouts or oversized requests would fail the same way elsewhere, so they
+// are returned without trying the other endpoints. Every attempt goes through
+// the rate limiter.
+func (p *RpcPool) Call(result any, method string, args ...any) error {
+	candidates := p.candidates()
+	if len(candidates) == 0 {
+		return fmt.Errorf("no RPC endpoint available")
+	}
+
+	var err error
+	var rpcErr rpc.Error
+
+	for _, endpoint := range candidates {
+		p.limiter.Wait(1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		start := time.Now()
+		err = endpoint.client.CallContext(ctx, result, method, args...)
+		cancel()
+		p.markResult(endpoint, time.Since(start), err)
+		p.recordThrottling(isThrottleError(err))
+
+		if err == nil || errors.As(err, &rpcErr) || isBatchSizeError(err) {
+			return err
+		}
+	}
+
+	return err
+}
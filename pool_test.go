@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testPoolEndpoint is an RPC server answering eth_blockNumber and failing every
+// other request with the given HTTP status.
+type testPoolEndpoint struct {
+	server   *httptest.Server
+	status   int
+	requests atomic.Int64 // Requests other than eth_blockNumber
+}
+
+func newTestPoolEndpoint(status int) *testPoolEndpoint {
+	endpoint := &testPoolEndpoint{status: status}
+
+	endpoint.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var request struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+
+		if !strings.HasPrefix(string(body), "[") && json.Unmarshal(body, &request) == nil && request.Method == "eth_blockNumber" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"jsonrpc":"2.0","id":` + string(request.ID) + `,"result":"0x10"}`))
+			return
+		}
+
+		endpoint.requests.Add(1)
+		http.Error(w, http.StatusText(endpoint.status), endpoint.status)
+	}))
+
+	return endpoint
+}
+
+func TestRpcPoolFailover(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantFailover bool // Whether the request is sent to the second endpoint
+		wantHealthy  bool // Whether the first endpoint stays healthy
+	}{
+		{name: "server error", status: http.StatusInternalServerError, wantFailover: true, wantHealthy: false},
+		{name: "bad gateway", status: http.StatusBadGateway, wantFailover: true, wantHealthy: false},
+		{name: "throttled", status: http.StatusTooManyRequests, wantFailover: true, wantHealthy: true},
+		{name: "batch too large", status: http.StatusRequestEntityTooLarge, wantFailover: false, wantHealthy: true},
+		{name: "request timeout", status: http.StatusRequestTimeout, wantFailover: false, wantHealthy: true},
+		{name: "gateway timeout", status: http.StatusGatewayTimeout, wantFailover: false, wantHealthy: true},
+	}
+
+	for _, test := range tests {
+		for _, batch := range []bool{false, true} {
+			first := newTestPoolEndpoint(test.status)
+			second := newTestPoolEndpoint(test.status)
+
+			pool, err := NewRpcPool(RpcConfig{
+				Endpoints: []EndpointConfig{{Url: first.server.URL}, {Url: second.server.URL}},
+				Strategy:  StrategyLeastLatency,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Send the request to the first endpoint.
+			pool.endpoints[0].latency = 1
+			pool.endpoints[1].latency = 2
+
+			var result string
+
+			if batch {
+				err = pool.BatchCall([]rpc.BatchElem{{Method: "eth_chainId", Result: &result}, {Method: "eth_chainId", Result: &result}})
+			} else {
+				err = pool.Call(&result, "eth_chainId")
+			}
+
+			if err == nil {
+				t.Errorf("%s (batch %t): request succeeded, want an error", test.name, batch)
+			}
+
+			if first.requests.Load() != 1 {
+				t.Errorf("%s (batch %t): %d requests to the first endpoint, want 1", test.name, batch, first.requests.Load())
+			}
+
+			if failover := second.requests.Load() > 0; failover != test.wantFailover {
+				t.Errorf("%s (batch %t): failover %t, want %t", test.name, batch, failover, test.wantFailover)
+			}
+
+			if healthy := pool.endpoints[0].healthy; healthy != test.wantHealthy {
+				t.Errorf("%s (batch %t): first endpoint healthy %t, want %t", test.name, batch, healthy, test.wantHealthy)
+			}
+
+			pool.Close()
+			first.server.Close()
+			second.server.Close()
+		}
+	}
+}
@@ -3,6 +3,13 @@ package main
 import (
 	"fmt"
 	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
 )
 
 /*
@@ -32,243 +39,379 @@ type RpcBlockMinimal struct {
 */
 
 func RpcBlockMinimalToBlockMinimal(rpcBlock *RpcBlockMinimal) (*BlockMinimal, error) {
-	hexStrings := []string{
-		rpcBlock.Difficulty,
-		rpcBlock.GasLimit,
-		rpcBlock.GasUsed,
-		rpcBlock.Nonce,
-		rpcBlock.Number,
-		rpcBlock.Size,
-		rpcBlock.Timestamp,
-		rpcBlock.TotalDifficulty,
+	d := NewFieldDecoder("block")
+
+	block := &BlockMinimal{
+		Timestamp:             d.Quantity("timestamp", rpcBlock.Timestamp),
+		Difficulty:            d.Quantity("difficulty", rpcBlock.Difficulty),
+		ExtraData:             d.Data("extraData", rpcBlock.ExtraData),
+		GasLimit:              d.Quantity("gasLimit", rpcBlock.GasLimit),
+		GasUsed:               d.Quantity("gasUsed", rpcBlock.GasUsed),
+		Hash:                  d.Hash("hash", rpcBlock.Hash),
+		LogsBloom:             d.Bloom("logsBloom", rpcBlock.LogsBloom),
+		Miner:                 d.Address("miner", rpcBlock.Miner),
+		MixHash:               d.OptionalHash("mixHash", rpcBlock.MixHash),
+		Nonce:                 d.OptionalQuantity("nonce", rpcBlock.Nonce),
+		Number:                d.Quantity("number", rpcBlock.Number),
+		ParentHash:            d.Hash("parentHash", rpcBlock.ParentHash),
+		ReceiptsRoot:          d.Hash("receiptsRoot", rpcBlock.ReceiptsRoot),
+		Sha3Uncles:            d.Hash("sha3Uncles", rpcBlock.Sha3Uncles),
+		Size:                  d.OptionalQuantity("size", rpcBlock.Size),
+		StateRoot:             d.Hash("stateRoot", rpcBlock.StateRoot),
+		TotalDifficulty:       d.OptionalQuantity("totalDifficulty", rpcBlock.TotalDifficulty),
+		TransactionsRoot:      d.Hash("transactionsRoot", rpcBlock.TransactionsRoot),
+		Uncles:                d.Hashes("uncles", rpcBlock.Uncles),
+		BaseFeePerGas:         d.OptionalQuantity("baseFeePerGas", rpcBlock.BaseFeePerGas),
+		BlobGasUsed:           d.OptionalQuantity("blobGasUsed", rpcBlock.BlobGasUsed),
+		ExcessBlobGas:         d.OptionalQuantity("excessBlobGas", rpcBlock.ExcessBlobGas),
+		ParentBeaconBlockRoot: d.OptionalHash("parentBeaconBlockRoot", rpcBlock.ParentBeaconBlockRoot),
+		WithdrawalsRoot:       d.OptionalHash("withdrawalsRoot", rpcBlock.WithdrawalsRoot),
+		RequestsHash:          d.OptionalHash("requestsHash", rpcBlock.RequestsHash),
+		Withdrawals:           decodeWithdrawals(d, rpcBlock.Withdrawals),
+		Transactions:          d.Hashes("transactions", rpcBlock.Transactions),
 	}
 
-	// Convert hex strings to big.Int
-	values, err := HexToBigIntMultiple(hexStrings)
+	if err := d.Err(); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert hex strings to big.Int: %w", err)
+	return block, nil
+}
+
+func RpcBlockFullToBlockFull(rpcBlock *RpcBlockFull) (*BlockFull, error) {
+	d := NewFieldDecoder("block")
+
+	transactions := make([]TransactionFull, len(rpcBlock.Transactions))
+
+	for i, tx := range rpcBlock.Transactions {
+		transactions[i] = decodeTransaction(d.Nested("transactions[%d]", i), &tx)
 	}
 
-	// Create a map to associate hex strings with their corresponding big.Int values
-	hexToBigIntMap := map[string]*big.Int{
-		rpcBlock.Difficulty:      values[0],
-		rpcBlock.GasLimit:        values[1],
-		rpcBlock.GasUsed:         values[2],
-		rpcBlock.Nonce:           values[3],
-		rpcBlock.Number:          values[4],
-		rpcBlock.Size:            values[5],
-		rpcBlock.Timestamp:       values[6],
-		rpcBlock.TotalDifficulty: values[7],
+	block := &BlockFull{
+		Timestamp:             d.Quantity("timestamp", rpcBlock.Timestamp),
+		Difficulty:            d.Quantity("difficulty", rpcBlock.Difficulty),
+		ExtraData:             d.Data("extraData", rpcBlock.ExtraData),
+		GasLimit:              d.Quantity("gasLimit", rpcBlock.GasLimit),
+		GasUsed:               d.Quantity("gasUsed", rpcBlock.GasUsed),
+		Hash:                  d.Hash("hash", rpcBlock.Hash),
+		LogsBloom:             d.Bloom("logsBloom", rpcBlock.LogsBloom),
+		Miner:                 d.Address("miner", rpcBlock.Miner),
+		MixHash:               d.OptionalHash("mixHash", rpcBlock.MixHash),
+		Nonce:                 d.OptionalQuantity("nonce", rpcBlock.Nonce),
+		Number:                d.Quantity("number", rpcBlock.Number),
+		ParentHash:            d.Hash("parentHash", rpcBlock.ParentHash),
+		ReceiptsRoot:          d.Hash("receiptsRoot", rpcBlock.ReceiptsRoot),
+		Sha3Uncles:            d.Hash("sha3Uncles", rpcBlock.Sha3Uncles),
+		Size:                  d.OptionalQuantity("size", rpcBlock.Size),
+		StateRoot:             d.Hash("stateRoot", rpcBlock.StateRoot),
+		TotalDifficulty:       d.OptionalQuantity("totalDifficulty", rpcBlock.TotalDifficulty),
+		TransactionsRoot:      d.Hash("transactionsRoot", rpcBlock.TransactionsRoot),
+		Uncles:                d.Hashes("uncles", rpcBlock.Uncles),
+		BaseFeePerGas:         d.OptionalQuantity("baseFeePerGas", rpcBlock.BaseFeePerGas),
+		BlobGasUsed:           d.OptionalQuantity("blobGasUsed", rpcBlock.BlobGasUsed),
+		ExcessBlobGas:         d.OptionalQuantity("excessBlobGas", rpcBlock.ExcessBlobGas),
+		ParentBeaconBlockRoot: d.OptionalHash("parentBeaconBlockRoot", rpcBlock.ParentBeaconBlockRoot),
+		WithdrawalsRoot:       d.OptionalHash("withdrawalsRoot", rpcBlock.WithdrawalsRoot),
+		RequestsHash:          d.OptionalHash("requestsHash", rpcBlock.RequestsHash),
+		Withdrawals:           decodeWithdrawals(d, rpcBlock.Withdrawals),
+		Transactions:          transactions,
 	}
 
-	block := &BlockMinimal{
-		Timestamp:        hexToBigIntMap[rpcBlock.Timestamp],
-		Difficulty:       hexToBigIntMap[rpcBlock.Difficulty],
-		ExtraData:        rpcBlock.ExtraData,
-		GasLimit:         hexToBigIntMap[rpcBlock.GasLimit],
-		GasUsed:          hexToBigIntMap[rpcBlock.GasUsed],
-		Hash:             rpcBlock.Hash,
-		LogsBloom:        rpcBlock.LogsBloom,
-		Miner:            rpcBlock.Miner,
-		MixHash:          rpcBlock.MixHash,
-		Nonce:            hexToBigIntMap[rpcBlock.Nonce],
-		Number:           hexToBigIntMap[rpcBlock.Number],
-		ParentHash:       rpcBlock.ParentHash,
-		ReceiptsRoot:     rpcBlock.ReceiptsRoot,
-		Sha3Uncles:       rpcBlock.Sha3Uncles,
-		Size:             hexToBigIntMap[rpcBlock.Size],
-		StateRoot:        rpcBlock.StateRoot,
-		TotalDifficulty:  hexToBigIntMap[rpcBlock.TotalDifficulty],
-		TransactionsRoot: rpcBlock.TransactionsRoot,
-		Uncles:           rpcBlock.Uncles,
-		Transactions:     rpcBlock.Transactions,
+	if err := d.Err(); err != nil {
+		return nil, err
 	}
 
 	return block, nil
 }
 
-func RpcBlockFullToBlockFull(rpcBlock *RpcBlockFull) (*BlockFull, error) {
-	hexStrings := []string{
-		rpcBlock.Difficulty,
-		rpcBlock.GasLimit,
-		rpcBlock.GasUsed,
-		rpcBlock.Nonce,
-		rpcBlock.Number,
-		rpcBlock.Size,
-		rpcBlock.Timestamp,
-		rpcBlock.TotalDifficulty,
+// decodeTransaction converts a transaction of a full block. Fields that only
+// exist for some transaction types are optional.
+func decodeTransaction(d *FieldDecoder, tx *RpcTransactionFull) TransactionFull {
+	accessList := make([]AccessTuple, len(tx.AccessList))
+
+	for i, tuple := range tx.AccessList {
+		tupleDecoder := d.Nested("accessList[%d]", i)
+
+		accessList[i] = AccessTuple{
+			Address:     tupleDecoder.Address("address", tuple.Address),
+			StorageKeys: tupleDecoder.Hashes("storageKeys", tuple.StorageKeys),
+		}
 	}
 
-	// Convert hex strings to big.Int
-	values, err := HexToBigIntMultiple(hexStrings)
+	if tx.AccessList == nil {
+		accessList = nil
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert hex strings to big.Int: %w", err)
+	return TransactionFull{
+		BlockHash:            d.Hash("blockHash", tx.BlockHash),
+		BlockNumber:          d.Quantity("blockNumber", tx.BlockNumber),
+		From:                 d.Address("from", tx.From),
+		Gas:                  d.Quantity("gas", tx.Gas),
+		GasPrice:             d.OptionalQuantity("gasPrice", tx.GasPrice),
+		Hash:                 d.Hash("hash", tx.Hash),
+		Input:                d.Data("input", tx.Input),
+		Nonce:                d.Quantity("nonce", tx.Nonce),
+		To:                   d.OptionalAddress("to", tx.To),
+		TransactionIndex:     d.Quantity("transactionIndex", tx.TransactionIndex),
+		Value:                d.Quantity("value", tx.Value),
+		Type:                 d.OptionalQuantity("type", tx.Type),
+		ChainId:              d.OptionalQuantity("chainId", tx.ChainId),
+		MaxFeePerGas:         d.OptionalQuantity("maxFeePerGas", tx.MaxFeePerGas),
+		MaxPriorityFeePerGas: d.OptionalQuantity("maxPriorityFeePerGas", tx.MaxPriorityFeePerGas),
+		AccessList:           accessList,
+		MaxFeePerBlobGas:     d.OptionalQuantity("maxFeePerBlobGas", tx.MaxFeePerBlobGas),
+		BlobVersionedHashes:  d.Hashes("blobVersionedHashes", tx.BlobVersionedHashes),
+		AuthorizationList:    decodeAuthorizations(d, tx.AuthorizationList),
+		V:                    d.QuantityString("v", tx.V),
+		R:                    d.QuantityString("r", tx.R),
+		S:                    d.QuantityString("s", tx.S),
+		YParity:              d.OptionalQuantityString("yParity", tx.YParity),
 	}
+}
 
-	// Create a map to associate hex strings with their corresponding big.Int values
-	hexToBigIntMap := map[string]*big.Int{
-		rpcBlock.Difficulty:      values[0],
-		rpcBlock.GasLimit:        values[1],
-		rpcBlock.GasUsed:         values[2],
-		rpcBlock.Nonce:           values[3],
-		rpcBlock.Number:          values[4],
-		rpcBlock.Size:            values[5],
-		rpcBlock.Timestamp:       values[6],
-		rpcBlock.TotalDifficulty: values[7],
+// decodeWithdrawals converts the withdrawals of a block. Blocks from before
+// Shanghai have no withdrawals and return nil.
+func decodeWithdrawals(d *FieldDecoder, rpcWithdrawals []RpcWithdrawal) []Withdrawal {
+	if rpcWithdrawals == nil {
+		return nil
 	}
 
-	transactions := make([]TransactionFull, len(rpcBlock.Transactions))
+	withdrawals := make([]Withdrawal, len(rpcWithdrawals))
 
-	for i, tx := range rpcBlock.Transactions {
-		hexStrings := []string{
-			tx.BlockNumber,
-			tx.Gas,
-			tx.GasPrice,
-			tx.Nonce,
-			tx.ChainId,
-			tx.Type,
-			tx.TransactionIndex,
-			tx.Value,
+	for i, withdrawal := range rpcWithdrawals {
+		withdrawalDecoder := d.Nested("withdrawals[%d]", i)
+
+		withdrawals[i] = Withdrawal{
+			Index:          withdrawalDecoder.Quantity("index", withdrawal.Index),
+			ValidatorIndex: withdrawalDecoder.Quantity("validatorIndex", withdrawal.ValidatorIndex),
+			Address:        withdrawalDecoder.Address("address", withdrawal.Address),
+			Amount:         withdrawalDecoder.Quantity("amount", withdrawal.Amount),
 		}
+	}
 
-		// Convert hex strings to big.Int
-		values, err := HexToBigIntMultiple(hexStrings)
+	return withdrawals
+}
 
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert hex strings to big.Int: %w", err)
-		}
+// decodeAuthorizations converts the authorization list of a set-code
+// transaction and recovers the authority of every tuple.
+func decodeAuthorizations(d *FieldDecoder, rpcAuthorizations []RpcAuthorization) []Authorization {
+	if rpcAuthorizations == nil {
+		return nil
+	}
 
-		// Create a map to associate hex strings with their corresponding big.Int values
-		hexToBigIntMap := map[string]*big.Int{
-			tx.BlockNumber:      values[0],
-			tx.Gas:              values[1],
-			tx.GasPrice:         values[2],
-			tx.Nonce:            values[3],
-			tx.ChainId:          values[4],
-			tx.Type:             values[5],
-			tx.TransactionIndex: values[6],
-			tx.Value:            values[7],
+	authorizations := make([]Authorization, len(rpcAuthorizations))
+
+	for i, authorization := range rpcAuthorizations {
+		authorizationDecoder := d.Nested("authorizationList[%d]", i)
+
+		chainId := authorizationDecoder.Quantity("chainId", authorization.ChainId)
+		address := authorizationDecoder.Address("address", authorization.Address)
+		nonce := authorizationDecoder.Quantity("nonce", authorization.Nonce)
+		yParity := authorizationDecoder.Quantity("yParity", authorization.YParity)
+		r := authorizationDecoder.Quantity("r", authorization.R)
+		s := authorizationDecoder.Quantity("s", authorization.S)
+
+		authorizations[i] = Authorization{
+			ChainId:   chainId,
+			Address:   address,
+			Nonce:     nonce,
+			YParity:   authorization.YParity,
+			R:         authorization.R,
+			S:         authorization.S,
+			Authority: recoverAuthority(chainId, address, nonce, yParity, r, s),
 		}
+	}
+
+	return authorizations
+}
 
-		transactions[i] = TransactionFull{
-			BlockHash:        tx.BlockHash,
-			BlockNumber:      hexToBigIntMap[tx.BlockNumber],
-			From:             tx.From,
-			Gas:              hexToBigIntMap[tx.Gas],
-			GasPrice:         hexToBigIntMap[tx.GasPrice],
-			Hash:             tx.Hash,
-			Input:            tx.Input,
-			Nonce:            hexToBigIntMap[tx.Nonce],
-			To:               tx.To,
-			TransactionIndex: hexToBigIntMap[tx.TransactionIndex],
-			Value:            hexToBigIntMap[tx.Value],
-			Type:             hexToBigIntMap[tx.Type],
-			ChainId:          hexToBigIntMap[tx.ChainId],
-			V:                tx.V,
-			R:                tx.R,
-			S:                tx.S,
+// recoverAuthority recovers the account that signed an authorization tuple.
+// It returns an empty string when a value is out of range or the signature is
+// invalid, in which case the authorization is skipped by the chain as well.
+func recoverAuthority(chainId *big.Int, address string, nonce *big.Int, yParity *big.Int, r *big.Int, s *big.Int) string {
+	for _, value := range []*big.Int{chainId, nonce, yParity, r, s} {
+		if value == nil {
+			return ""
 		}
+	}
 
+	if !common.IsHexAddress(address) || !nonce.IsUint64() || yParity.Cmp(big.NewInt(255)) > 0 {
+		return ""
 	}
 
-	block := &BlockFull{
-		Timestamp:        hexToBigIntMap[rpcBlock.Timestamp],
-		Difficulty:       hexToBigIntMap[rpcBlock.Difficulty],
-		ExtraData:        rpcBlock.ExtraData,
-		GasLimit:         hexToBigIntMap[rpcBlock.GasLimit],
-		GasUsed:          hexToBigIntMap[rpcBlock.GasUsed],
-		Hash:             rpcBlock.Hash,
-		LogsBloom:        rpcBlock.LogsBloom,
-		Miner:            rpcBlock.Miner,
-		MixHash:          rpcBlock.MixHash,
-		Nonce:            hexToBigIntMap[rpcBlock.Nonce],
-		Number:           hexToBigIntMap[rpcBlock.Number],
-		ParentHash:       rpcBlock.ParentHash,
-		ReceiptsRoot:     rpcBlock.ReceiptsRoot,
-		Sha3Uncles:       rpcBlock.Sha3Uncles,
-		Size:             hexToBigIntMap[rpcBlock.Size],
-		StateRoot:        rpcBlock.StateRoot,
-		TotalDifficulty:  hexToBigIntMap[rpcBlock.TotalDifficulty],
-		TransactionsRoot: rpcBlock.TransactionsRoot,
-		Uncles:           rpcBlock.Uncles,
-		Transactions:     transactions,
+	chainIdValue, overflow := uint256.FromBig(chainId)
+	if overflow {
+		return ""
 	}
 
-	return block, nil
-}
+	rValue, overflowR := uint256.FromBig(r)
+	sValue, overflowS := uint256.FromBig(s)
+	if overflowR || overflowS {
+		return ""
+	}
 
-func RpcReceiptToReceipt(rpcReceipt *RpcReceipt) (*Receipt, error) {
-	hexStrings := []string{
-		rpcReceipt.BlockNumber,
-		rpcReceipt.CumulativeGasUsed,
-		rpcReceipt.EffectiveGasPrice,
-		rpcReceipt.GasUsed,
-		rpcReceipt.TransactionIndex,
-		rpcReceipt.ContractAddress,
+	tuple := types.SetCodeAuthorization{
+		ChainID: *chainIdValue,
+		Address: common.HexToAddress(address),
+		Nonce:   nonce.Uint64(),
+		V:       uint8(yParity.Uint64()),
+		R:       *rValue,
+		S:       *sValue,
+	}
+
+	authority, err := tuple.Authority()
+	if err != nil {
+		return ""
 	}
 
-	// Convert hex strings to big.Int
-	values, err := HexToBigIntMultiple(hexStrings)
+	return strings.ToLower(authority.Hex())
+}
 
+// ParseDelegation returns the address an account delegates its code to when
+// its code is an EIP-7702 delegation designator (0xef0100 followed by an address).
+func ParseDelegation(code string) (string, bool) {
+	bytes, err := hexutil.Decode(code)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert hex strings to big.Int: %w", err)
+		return "", false
 	}
 
-	// Create a map to associate hex strings with their corresponding big.Int values
-	hexToBigIntMap := map[string]*big.Int{
-		rpcReceipt.BlockNumber:       values[0],
-		rpcReceipt.CumulativeGasUsed: values[1],
-		rpcReceipt.EffectiveGasPrice: values[2],
-		rpcReceipt.GasUsed:           values[3],
-		rpcReceipt.TransactionIndex:  values[4],
-		rpcReceipt.Type:              values[5],
+	address, ok := types.ParseDelegation(bytes)
+	if !ok {
+		return "", false
 	}
 
+	return strings.ToLower(address.Hex()), true
+}
+
+func RpcReceiptToReceipt(rpcReceipt *RpcReceipt) (*Receipt, error) {
+	d := NewFieldDecoder("receipt")
+
 	logs := make([]Log, len(rpcReceipt.Logs))
 
 	for i, log := range rpcReceipt.Logs {
-		hexStrings := []string{
-			log.LogIndex,
-		}
+		logs[i] = decodeLog(d.Nested("logs[%d]", i), &log)
+	}
 
-		// Convert hex strings to big.Int
-		values, err := HexToBigIntMultiple(hexStrings)
+	receipt := &Receipt{
+		BlockHash:         d.Hash("blockHash", rpcReceipt.BlockHash),
+		BlockNumber:       d.Quantity("blockNumber", rpcReceipt.BlockNumber),
+		ContractAddress:   d.OptionalAddress("contractAddress", rpcReceipt.ContractAddress),
+		CumulativeGasUsed: d.Quantity("cumulativeGasUsed", rpcReceipt.CumulativeGasUsed),
+		GasUsed:           d.Quantity("gasUsed", rpcReceipt.GasUsed),
+		Status:            d.OptionalQuantityString("status", rpcReceipt.Status),
+		Root:              d.OptionalHash("root", rpcReceipt.Root),
+		To:                d.OptionalAddress("to", rpcReceipt.To),
+		TransactionHash:   d.Hash("transactionHash", rpcReceipt.TransactionHash),
+		TransactionIndex:  d.Quantity("transactionIndex", rpcReceipt.TransactionIndex),
+		Logs:              logs,
+		LogsBloom:         d.Bloom("logsBloom", rpcReceipt.LogsBloom),
+		From:              d.Address("from", rpcReceipt.From),
+		EffectiveGasPrice: d.OptionalQuantity("effectiveGasPrice", rpcReceipt.EffectiveGasPrice),
+		Type:              d.OptionalQuantity("type", rpcReceipt.Type),
+		BlobGasUsed:       d.OptionalQuantity("blobGasUsed", rpcReceipt.BlobGasUsed),
+		BlobGasPrice:      d.OptionalQuantity("blobGasPrice", rpcReceipt.BlobGasPrice),
+	}
 
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert hex strings to big.Int: %w", err)
-		}
+	if err := d.Err(); err != nil {
+		return nil, err
+	}
 
-		hexToBigIntMap[log.LogIndex] = values[0]
-
-		logs[i] = Log{
-			Address:          log.Address,
-			Topics:           log.Topics,
-			Data:             log.Data,
-			BlockNumber:      hexToBigIntMap[log.BlockNumber],
-			TransactionHash:  log.TransactionHash,
-			TransactionIndex: hexToBigIntMap[log.TransactionIndex],
-			BlockHash:        log.BlockHash,
-			LogIndex:         hexToBigIntMap[log.LogIndex],
-			Removed:          log.Removed,
+	return receipt, nil
+}
+
+// RpcLogsToLogs converts the logs of an eth_getLogs response.
+func RpcLogsToLogs(rpcLogs []RpcLog) ([]Log, error) {
+	logs := make([]Log, len(rpcLogs))
+
+	for i, log := range rpcLogs {
+		d := NewFieldDecoder(fmt.Sprintf("logs[%d]", i))
+		logs[i] = decodeLog(d, &log)
+
+		if err := d.Err(); err != nil {
+			return nil, err
 		}
 	}
 
-	return &Receipt{
-		BlockHash:         rpcReceipt.BlockHash,
-		BlockNumber:       hexToBigIntMap[rpcReceipt.BlockNumber],
-		ContractAddress:   rpcReceipt.ContractAddress,
-		CumulativeGasUsed: hexToBigIntMap[rpcReceipt.CumulativeGasUsed],
-		GasUsed:           hexToBigIntMap[rpcReceipt.GasUsed],
-		Status:            rpcReceipt.Status,
-		To:                rpcReceipt.To,
-		TransactionHash:   rpcReceipt.TransactionHash,
-		TransactionIndex:  hexToBigIntMap[rpcReceipt.TransactionIndex],
-		Logs:              logs,
-		LogsBloom:         rpcReceipt.LogsBloom,
-		From:              rpcReceipt.From,
-		EffectiveGasPrice: hexToBigIntMap[rpcReceipt.EffectiveGasPrice],
-		Type:              hexToBigIntMap[rpcReceipt.Type],
-	}, nil
+	return logs, nil
+}
+
+// decodeLog converts a log of a receipt or of an eth_getLogs response.
+func decodeLog(d *FieldDecoder, log *RpcLog) Log {
+	return Log{
+		Address:          d.Address("address", log.Address),
+		Topics:           d.Hashes("topics", log.Topics),
+		Data:             d.Data("data", log.Data),
+		BlockNumber:      d.Quantity("blockNumber", log.BlockNumber),
+		TransactionHash:  d.Hash("transactionHash", log.TransactionHash),
+		TransactionIndex: d.Quantity("transactionIndex", log.TransactionIndex),
+		BlockHash:        d.Hash("blockHash", log.BlockHash),
+		LogIndex:         d.Quantity("logIndex", log.LogIndex),
+		Removed:          log.Removed,
+	}
+}
+
+// FlattenTransactionTrace converts the call frames of the index-th transaction
+// trace of a block, whose hash is transactionHash, into internal transactions,
+// in execution order.
+func FlattenTransactionTrace(blockNumber *big.Int, index int, transactionHash string, trace *RpcTransactionTrace) ([]InternalTransaction, error) {
+	if trace.Error != "" {
+		return nil, fmt.Errorf("traces[%d]: %s", index, trace.Error)
+	}
+
+	if trace.Result == nil {
+		return nil, fmt.Errorf("traces[%d]: missing result", index)
+	}
+
+	// Only recent nodes return the hash with the trace
+	if trace.TxHash != "" && !strings.EqualFold(trace.TxHash, transactionHash) {
+		return nil, fmt.Errorf("traces[%d]: trace of transaction %s instead of %s", index, trace.TxHash, transactionHash)
+	}
+
+	d := NewFieldDecoder(fmt.Sprintf("traces[%d]", index))
+
+	base := InternalTransaction{
+		BlockNumber:      blockNumber,
+		TransactionHash:  d.Hash("txHash", transactionHash),
+		TransactionIndex: index,
+	}
+
+	calls := decodeCallFrame(d.Nested("result"), trace.Result, base, []int{}, false, nil)
+
+	if err := d.Err(); err != nil {
+		return nil, err
+	}
+
+	return calls, nil
+}
+
+// decodeCallFrame appends the frame and then its subcalls to calls. A frame is
+// reverted when it or one of its parents failed.
+func decodeCallFrame(d *FieldDecoder, frame *RpcCallFrame, base InternalTransaction, traceAddress []int, parentReverted bool, calls []InternalTransaction) []InternalTransaction {
+	call := base
+	call.TraceAddress = traceAddress
+	call.Type = strings.ToUpper(frame.Type)
+	call.From = d.Address("from", frame.From)
+	call.To = d.OptionalAddress("to", frame.To)
+	call.Value = d.OptionalQuantity("value", frame.Value)
+
+	// The callTracer reports the value of the parent frame on a DELEGATECALL
+	if call.Type == "DELEGATECALL" || call.Type == "STATICCALL" {
+		call.Value = nil
+	}
+
+	call.Gas = d.OptionalQuantity("gas", frame.Gas)
+	call.GasUsed = d.OptionalQuantity("gasUsed", frame.GasUsed)
+	call.Input = d.OptionalData("input", frame.Input)
+	call.Output = d.OptionalData("output", frame.Output)
+	call.Error = frame.Error
+	call.RevertReason = frame.RevertReason
+	call.Reverted = parentReverted || frame.Error != ""
+
+	calls = append(calls, call)
+
+	for i := range frame.Calls {
+		calls = decodeCallFrame(d.Nested("calls[%d]", i), &frame.Calls[i], base, append(slices.Clone(traceAddress), i), call.Reverted, calls)
+	}
+
+	return calls
 }
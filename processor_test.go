@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRpcReceiptToReceipt(t *testing.T) {
+	newReceipt := func() *RpcReceipt {
+		return &RpcReceipt{
+			BlockHash:         "0x" + strings.Repeat("11", 32),
+			BlockNumber:       "0x10",
+			CumulativeGasUsed: "0x5208",
+			GasUsed:           "0x5208",
+			Status:            "0x1",
+			TransactionHash:   "0x" + strings.Repeat("22", 32),
+			TransactionIndex:  "0x0",
+			LogsBloom:         "0x" + strings.Repeat("00", 256),
+			From:              "0x" + strings.Repeat("33", 20),
+			EffectiveGasPrice: "0x3b9aca00",
+			Type:              "0x2",
+		}
+	}
+
+	contractAddress := "0x" + strings.Repeat("44", 20)
+
+	tests := []struct {
+		name    string
+		modify  func(r *RpcReceipt)
+		wantErr string // Prefix of the error, empty when the conversion succeeds
+	}{
+		{
+			name:   "call",
+			modify: func(r *RpcReceipt) { r.To = "0x" + strings.Repeat("55", 20) },
+		},
+		{
+			// The contract address used to be decoded in place of the type.
+			name:   "contract creation",
+			modify: func(r *RpcReceipt) { r.ContractAddress = contractAddress },
+		},
+		{
+			name:    "missing block number",
+			modify:  func(r *RpcReceipt) { r.BlockNumber = "" },
+			wantErr: "receipt.blockNumber: missing value",
+		},
+		{
+			name:    "invalid contract address",
+			modify:  func(r *RpcReceipt) { r.ContractAddress = "0x12" },
+			wantErr: "receipt.contractAddress:",
+		},
+		{
+			name:    "invalid type",
+			modify:  func(r *RpcReceipt) { r.Type = "0x-2" },
+			wantErr: "receipt.type: invalid hex quantity",
+		},
+		{
+			name: "invalid log",
+			modify: func(r *RpcReceipt) {
+				r.Logs = []RpcLog{{Address: "0x12"}}
+			},
+			wantErr: "receipt.logs[0].",
+		},
+	}
+
+	for _, test := range tests {
+		rpcReceipt := newReceipt()
+		test.modify(rpcReceipt)
+
+		receipt, err := RpcReceiptToReceipt(rpcReceipt)
+
+		if test.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.wantErr) {
+				t.Errorf("%s: error %v, want %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if receipt.Type == nil || receipt.Type.Int64() != 2 {
+			t.Errorf("%s: type %v, want 2", test.name, receipt.Type)
+		}
+
+		if receipt.ContractAddress != rpcReceipt.ContractAddress {
+			t.Errorf("%s: contract address %q, want %q", test.name, receipt.ContractAddress, rpcReceipt.ContractAddress)
+		}
+	}
+}
+
+func TestFlattenTransactionTrace(t *testing.T) {
+	address := func(b string) string { return "0x" + strings.Repeat(b, 20) }
+	hash := "0x" + strings.Repeat("22", 32)
+
+	newTrace := func() *RpcTransactionTrace {
+		return &RpcTransactionTrace{
+			TxHash: hash,
+			Result: &RpcCallFrame{
+				Type: "CALL", From: address("aa"), To: address("bb"), Value: "0x10", Gas: "0x5208", GasUsed: "0x5000", Input: "0x",
+				Calls: []RpcCallFrame{
+					{Type: "DELEGATECALL", From: address("bb"), To: address("cc"), Input: "0x12345678"},
+					{
+						Type: "CALL", From: address("bb"), To: address("dd"), Value: "0x1", Error: "execution reverted",
+						Calls: []RpcCallFrame{{Type: "STATICCALL", From: address("dd"), To: address("ee")}},
+					},
+					{Type: "CREATE", From: address("bb"), To: address("ff"), Value: "0x0"},
+				},
+			},
+		}
+	}
+
+	// Trace address, type, value and reverted flag of the frames of newTrace
+	callTree := []string{
+		"[] CALL 16 false",
+		"[0] DELEGATECALL <nil> false",
+		"[1] CALL 1 true",
+		"[1 0] STATICCALL <nil> true",
+		"[2] CREATE 0 false",
+	}
+
+	tests := []struct {
+		name            string
+		modify          func(trace *RpcTransactionTrace)
+		transactionHash string
+		wantCalls       []string
+		wantErr         string // Prefix of the error, empty when the trace is flattened
+	}{
+		{
+			name:            "call tree",
+			modify:          func(trace *RpcTransactionTrace) {},
+			transactionHash: hash,
+			wantCalls:       callTree,
+		},
+		{
+			name:            "trace without hash",
+			modify:          func(trace *RpcTransactionTrace) { trace.TxHash = "" },
+			transactionHash: hash,
+			wantCalls:       callTree,
+		},
+		{
+			name:            "hash in upper case",
+			modify:          func(trace *RpcTransactionTrace) { trace.TxHash = "0x" + strings.ToUpper(hash[2:]) },
+			transactionHash: hash,
+			wantCalls:       callTree,
+		},
+		{
+			name: "delegated value",
+			modify: func(trace *RpcTransactionTrace) {
+				trace.Result.Calls[0].Value = "0x10"
+				trace.Result.Calls[1].Calls[0].Value = "0x0"
+			},
+			transactionHash: hash,
+			wantCalls:       callTree,
+		},
+		{
+			name:            "trace of another transaction",
+			modify:          func(trace *RpcTransactionTrace) {},
+			transactionHash: "0x" + strings.Repeat("33", 32),
+			wantErr:         "traces[2]: trace of transaction",
+		},
+		{
+			name:            "invalid transaction hash",
+			modify:          func(trace *RpcTransactionTrace) { trace.TxHash = "" },
+			transactionHash: "0x12",
+			wantErr:         "traces[2].txHash:",
+		},
+		{
+			name:            "failed trace",
+			modify:          func(trace *RpcTransactionTrace) { trace.Result, trace.Error = nil, "execution timeout" },
+			transactionHash: hash,
+			wantErr:         "traces[2]: execution timeout",
+		},
+		{
+			name:            "missing result",
+			modify:          func(trace *RpcTransactionTrace) { trace.Result = nil },
+			transactionHash: hash,
+			wantErr:         "traces[2]: missing result",
+		},
+		{
+			name:            "invalid frame",
+			modify:          func(trace *RpcTransactionTrace) { trace.Result.Calls[1].Calls[0].From = "0x12" },
+			transactionHash: hash,
+			wantErr:         "traces[2].result.calls[1].calls[0].from:",
+		},
+	}
+
+	for _, test := range tests {
+		trace := newTrace()
+		test.modify(trace)
+
+		calls, err := FlattenTransactionTrace(big.NewInt(100), 2, test.transactionHash, trace)
+
+		if test.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.wantErr) {
+				t.Errorf("%s: error %v, want %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		got := make([]string, 0, len(calls))
+
+		for _, call := range calls {
+			got = append(got, fmt.Sprintf("%v %s %v %t", call.TraceAddress, call.Type, call.Value, call.Reverted))
+
+			if call.BlockNumber.Int64() != 100 || call.TransactionIndex != 2 || call.TransactionHash != test.transactionHash {
+				t.Errorf("%s: call %v of block %v, transaction %d %s", test.name, call.TraceAddress, call.BlockNumber, call.TransactionIndex, call.TransactionHash)
+			}
+		}
+
+		if !slices.Equal(got, test.wantCalls) {
+			t.Errorf("%s: calls %v, want %v", test.name, got, test.wantCalls)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Substrings of error messages used by providers to signal throttling.
+var throttleMessages = []string{
+	"rate limit",
+	"rate-limit",
+	"ratelimit",
+	"too many requests",
+	"throttl",
+	"capacity exceeded",
+}
+
+// JSON-RPC error codes used by providers to signal throttling.
+var throttleCodes = map[int]bool{
+	-32005: true, // Limit exceeded (EIP-1474)
+	429:    true,
+}
+
+// tokenBucket refills at rate tokens per second up to burst tokens.
+// The balance may go negative: callers then wait until it is paid back.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// take removes n tokens at the given rate factor and returns how long the
+// caller has to wait before the tokens are actually available.
+func (b *tokenBucket) take(n float64, factor float64, now time.Time) time.Duration {
+	rate := b.rate * factor
+
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// RateLimiter limits the requests and batch elements sent per second. It halves
+// its rates when the provider throttles and recovers them gradually afterwards.
+type RateLimiter struct {
+	mu           sync.Mutex
+	requests     *tokenBucket // nil when unlimited
+	elements     *tokenBucket // nil when unlimited
+	factor       float64      // Fraction of the configured rates currently in use
+	minFactor    float64
+	recoveryStep float64
+}
+
+// requestsPerSecond returns the configured request rate, derived from the
+// legacy delay setting when no rate is configured.
+func (r RpcConfig) requestsPerSecond() float64 {
+	if r.RateLimit.RequestsPerSecond > 0 {
+		return r.RateLimit.RequestsPerSecond
+	}
+
+	if r.Delay > 0 {
+		return 1000 / float64(r.Delay)
+	}
+
+	return 0
+}
+
+// NewRateLimiter creates the limiter for the given RPC configuration.
+func NewRateLimiter(config RpcConfig) *RateLimiter {
+	limiter := &RateLimiter{
+		factor:       1,
+		minFactor:    config.RateLimit.MinFactor,
+		recoveryStep: config.RateLimit.RecoveryStep,
+	}
+
+	if limiter.minFactor <= 0 || limiter.minFactor > 1 {
+		limiter.minFactor = DefaultRateLimitMinFactor
+	}
+
+	if limiter.recoveryStep <= 0 {
+		limiter.recoveryStep = DefaultRateLimitRecoveryStep
+	}
+
+	if rps := config.requestsPerSecond(); rps > 0 {
+		limiter.requests = newTokenBucket(rps)
+	}
+
+	if eps := config.RateLimit.ElementsPerSecond; eps > 0 {
+		limiter.elements = newTokenBucket(eps)
+	}
+
+	return limiter
+}
+
+// String describes the configured rates for logging.
+func (l *RateLimiter) String() string {
+	describe := func(bucket *tokenBucket) string {
+		if bucket == nil {
+			return "unlimited"
+		}
+		return fmt.Sprintf("%.2f/s", bucket.rate)
+	}
+
+	return fmt.Sprintf("requests %s, batch elements %s", describe(l.requests), describe(l.elements))
+}
+
+// Wait blocks until a request carrying the given number of batch elements may be sent.
+func (l *RateLimiter) Wait(elements int) {
+	l.mu.Lock()
+	now := time.Now()
+	wait := time.Duration(0)
+
+	if l.requests != nil {
+		wait = l.requests.take(1, l.factor, now)
+	}
+
+	if l.elements != nil {
+		if elementWait := l.elements.take(float64(elements), l.factor, now); elementWait > wait {
+			wait = elementWait
+		}
+	}
+	l.mu.Unlock()
+
+	time.Sleep(wait)
+}
+
+// Throttled slows the limiter down after the provider rejected a request.
+func (l *RateLimiter) Throttled() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.requests == nil && l.elements == nil {
+		return
+	}
+
+	factor := l.factor / 2
+	if factor < l.minFactor {
+		factor = l.minFactor
+	}
+
+	if factor != l.factor {
+		log.Printf("Provider is throttling, slowing down to %.0f%% of the configured rate\n", factor*100)
+	}
+
+	l.factor = factor
+}
+
+// Succeeded lets the limiter recover gradually after a successful request.
+func (l *RateLimiter) Succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.factor >= 1 {
+		return
+	}
+
+	l.factor += l.recoveryStep
+	if l.factor >= 1 {
+		l.factor = 1
+		log.Printf("Rate limit fully recovered\n")
+	}
+}
+
+// isThrottleError reports whether the error is an HTTP 429 or a JSON-RPC
+// error signalling that the provider is rate limiting us.
+func isThrottleError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && throttleCodes[rpcErr.ErrorCode()] {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, throttleMessage := range throttleMessages {
+		if strings.Contains(message, throttleMessage) {
+			return true
+		}
+	}
+
+	return false
+}
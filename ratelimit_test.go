@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testRpcError is a JSON-RPC error returned by a node.
+type testRpcError struct {
+	code    int
+	message string
+}
+
+func (e testRpcError) Error() string  { return e.message }
+func (e testRpcError) ErrorCode() int { return e.code }
+
+func TestTokenBucketTake(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name   string
+		rate   float64
+		tokens float64 // Balance before taking
+		after  time.Duration
+		n      float64
+		factor float64
+		want   time.Duration
+	}{
+		{name: "within burst", rate: 10, tokens: 10, n: 1, factor: 1, want: 0},
+		{name: "whole burst", rate: 10, tokens: 10, n: 10, factor: 1, want: 0},
+		{name: "beyond burst", rate: 10, tokens: 0, n: 1, factor: 1, want: 100 * time.Millisecond},
+		{name: "debt", rate: 10, tokens: -1, n: 1, factor: 1, want: 200 * time.Millisecond},
+		{name: "refill", rate: 10, tokens: 0, after: 100 * time.Millisecond, n: 1, factor: 1, want: 0},
+		{name: "refill capped at burst", rate: 10, tokens: 0, after: time.Hour, n: 11, factor: 1, want: 100 * time.Millisecond},
+		{name: "throttled", rate: 10, tokens: 0, n: 1, factor: 0.5, want: 200 * time.Millisecond},
+		{name: "throttled refill", rate: 10, tokens: 0, after: 100 * time.Millisecond, n: 1, factor: 0.5, want: 100 * time.Millisecond},
+		{name: "rate below one", rate: 0.5, tokens: 0, n: 1, factor: 1, want: 2 * time.Second},
+		{name: "element batch", rate: 100, tokens: 100, n: 150, factor: 1, want: 500 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		bucket := newTokenBucket(test.rate)
+		bucket.tokens = test.tokens
+		bucket.last = start
+
+		wait := bucket.take(test.n, test.factor, start.Add(test.after))
+
+		if diff := wait - test.want; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("%s: wait %v, want %v", test.name, wait, test.want)
+		}
+	}
+}
+
+func TestRateLimiterFactor(t *testing.T) {
+	limiter := NewRateLimiter(RpcConfig{RateLimit: RateLimitConfig{RequestsPerSecond: 10, MinFactor: 0.2, RecoveryStep: 0.1}})
+
+	steps := []struct {
+		throttled bool
+		want      float64
+	}{
+		{throttled: true, want: 0.5},
+		{throttled: true, want: 0.25},
+		{throttled: true, want: 0.2}, // Bounded by the minimum factor
+		{throttled: true, want: 0.2},
+		{throttled: false, want: 0.3},
+		{throttled: false, want: 0.4},
+		{throttled: true, want: 0.2},
+		{throttled: false, want: 0.3},
+		{throttled: false, want: 0.4},
+		{throttled: false, want: 0.5},
+		{throttled: false, want: 0.6},
+		{throttled: false, want: 0.7},
+		{throttled: false, want: 0.8},
+		{throttled: false, want: 0.9},
+		{throttled: false, want: 1},
+		{throttled: false, want: 1}, // Bounded by the configured rate
+	}
+
+	for i, step := range steps {
+		if step.throttled {
+			limiter.Throttled()
+		} else {
+			limiter.Succeeded()
+		}
+
+		if math.Abs(limiter.factor-step.want) > 1e-9 {
+			t.Fatalf("step %d: factor %v, want %v", i, limiter.factor, step.want)
+		}
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       RpcConfig
+		wantRequests float64 // Zero when unlimited
+		wantElements float64 // Zero when unlimited
+	}{
+		{name: "unlimited", config: RpcConfig{}},
+		{name: "requests", config: RpcConfig{RateLimit: RateLimitConfig{RequestsPerSecond: 25}}, wantRequests: 25},
+		{name: "elements", config: RpcConfig{RateLimit: RateLimitConfig{ElementsPerSecond: 500}}, wantElements: 500},
+		{name: "legacy delay", config: RpcConfig{Delay: 200}, wantRequests: 5},
+		{name: "rate over delay", config: RpcConfig{Delay: 200, RateLimit: RateLimitConfig{RequestsPerSecond: 8}}, wantRequests: 8},
+	}
+
+	rate := func(bucket *tokenBucket) float64 {
+		if bucket == nil {
+			return 0
+		}
+		return bucket.rate
+	}
+
+	for _, test := range tests {
+		limiter := NewRateLimiter(test.config)
+
+		if got := rate(limiter.requests); got != test.wantRequests {
+			t.Errorf("%s: request rate %v, want %v", test.name, got, test.wantRequests)
+		}
+
+		if got := rate(limiter.elements); got != test.wantElements {
+			t.Errorf("%s: element rate %v, want %v", test.name, got, test.wantElements)
+		}
+
+		if limiter.minFactor != DefaultRateLimitMinFactor || limiter.recoveryStep != DefaultRateLimitRecoveryStep {
+			t.Errorf("%s: factors %v and %v, want the defaults", test.name, limiter.minFactor, limiter.recoveryStep)
+		}
+	}
+}
+
+func TestIsThrottleError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: rpc.HTTPError{StatusCode: 429, Status: "429 Too Many Requests"}, want: true},
+		{err: fmt.Errorf("batch failed: %w", rpc.HTTPError{StatusCode: 429}), want: true},
+		{err: rpc.HTTPError{StatusCode: 503, Status: "503 Service Unavailable"}, want: false},
+		{err: testRpcError{code: -32005, message: "limit exceeded"}, want: true},
+		{err: testRpcError{code: -32000, message: "daily request count exceeded, request rate limited"}, want: true},
+		{err: testRpcError{code: -32000, message: "execution reverted"}, want: false},
+		{err: errors.New("Too Many Requests"), want: true},
+		{err: errors.New("connection refused"), want: false},
+	}
+
+	for _, test := range tests {
+		if got := isThrottleError(test.err); got != test.want {
+			t.Errorf("isThrottleError(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
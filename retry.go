@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var errEmptyResult = errors.New("empty result")
+
+// FailedRequest describes a request that still failed after all retry attempts.
+type FailedRequest struct {
+	Method   string `json:"method"`
+	Args     []any  `json:"args"`
+	Error    string `json:"error"`
+	Attempts uint64 `json:"attempts"`
+}
+
+// maxAttempts returns the configured number of attempts, falling back to the default.
+func (r RetryConfig) maxAttempts() uint64 {
+	if r.MaxAttempts == 0 {
+		return DefaultRetryMaxAttempts
+	}
+
+	return r.MaxAttempts
+}
+
+// backoff returns the delay to wait before the given retry (1 for the first retry).
+func (r RetryConfig) backoff(retry uint64) time.Duration {
+	initial := r.InitialBackoff
+	if initial == 0 {
+		initial = DefaultRetryInitialBackoff
+	}
+
+	maxBackoff := r.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = DefaultRetryMaxBackoff
+	}
+
+	delay := initial
+	for i := uint64(1); i < retry && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	jitter := r.Jitter
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+
+	// Spread the delay over [delay * (1 - jitter), delay * (1 + jitter)]
+	factor := 1 + jitter*(rand.Float64()*2-1)
+
+	return time.Duration(float64(delay)*factor) * time.Millisecond
+}
+
+// isEmptyResult reports whether a batch element came back without a result.
+func isEmptyResult(result any) bool {
+	raw, ok := result.(*json.RawMessage)
+	if !ok {
+		return false
+	}
+
+	return raw == nil || len(*raw) == 0 || string(*raw) == "null"
+}
+
+// BatchCallWithRetry executes the batch and re-queues every failed element on its own
+// (whole-batch errors, element errors and empty results) with exponential backoff.
+// When sizer is set, the elements are sent in sub-batches of its effective size,
+// which is halved whenever the node rejects or times out on a sub-batch.
+// Elements that still fail after the last attempt keep their error in batch[i].Error
+// and are returned as failed requests.
+func BatchCallWithRetry(client *RpcPool, batch []rpc.BatchElem, retry RetryConfig, sizer *AdaptiveBatchSize) []FailedRequest {
+	pending := make([]int, len(batch))
+	for i := range batch {
+		pending[i] = i
+	}
+
+	maxAttempts := retry.maxAttempts()
+	attempt := uint64(1)
+
+	for {
+		retryable := make([]int, 0)
+
+		for len(pending) > 0 {
+			size := len(pending)
+			if sizer != nil && sizer.Size() < size {
+				size = sizer.Size()
+			}
+
+			chunk := pending[:size]
+			pending = pending[size:]
+
+			err := sendBatchChunk(client, batch, chunk)
+
+			if err != nil {
+				log.Printf("batch call failed (attempt %d/%d): %v", attempt, maxAttempts, err)
+			}
+
+			failed := make([]int, 0)
+			sizeRejected := isBatchSizeError(err)
+
+			for _, idx := range chunk {
+				if batch[idx].Error != nil {
+					failed = append(failed, idx)
+					sizeRejected = sizeRejected || isBatchSizeError(batch[idx].Error)
+				}
+			}
+
+			// Split the chunk and send the failed elements again right away,
+			// without consuming an attempt.
+			if sizer != nil && sizeRejected && len(chunk) > 1 {
+				sizer.Shrink(len(chunk))
+				pending = append(failed, pending...)
+				continue
+			}
+
+			if len(failed) == 0 && sizer != nil {
+				sizer.Grow()
+			}
+
+			retryable = append(retryable, failed...)
+		}
+
+		if len(retryable) == 0 || attempt >= maxAttempts {
+			pending = retryable
+			break
+		}
+
+		attempt++
+		time.Sleep(retry.backoff(attempt - 1))
+
+		pending = retryable
+	}
+
+	failed := make([]FailedRequest, 0, len(pending))
+
+	for _, idx := range pending {
+		log.Printf("giving up on %s %v after %d attempts: %v", batch[idx].Method, batch[idx].Args, attempt, batch[idx].Error)
+
+		failed = append(failed, FailedRequest{
+			Method:   batch[idx].Method,
+			Args:     batch[idx].Args,
+			Error:    batch[idx].Error.Error(),
+			Attempts: attempt,
+		})
+	}
+
+	return failed
+}
+
+// sendBatchChunk sends the elements of batch at the given indices as a single
+// batch call and stores the outcome of each element in batch[i].Error.
+func sendBatchChunk(client *RpcPool, batch []rpc.BatchElem, chunk []int) error {
+	elems := make([]rpc.BatchElem, len(chunk))
+	for j, idx := range chunk {
+		if raw, ok := batch[idx].Result.(*json.RawMessage); ok && raw != nil {
+			*raw = nil
+		}
+
+		elems[j] = rpc.BatchElem{
+			Method: batch[idx].Method,
+			Args:   batch[idx].Args,
+			Result: batch[idx].Result,
+		}
+	}
+
+	err := client.BatchCall(elems)
+
+	for j, idx := range chunk {
+		switch {
+		case err != nil:
+			batch[idx].Error = err
+		case elems[j].Error != nil:
+			batch[idx].Error = elems[j].Error
+		case isEmptyResult(elems[j].Result):
+			batch[idx].Error = errEmptyResult
+		default:
+			batch[idx].Error = nil
+		}
+	}
+
+	return err
+}
+
+// CallWithRetry executes a single call with exponential backoff between attempts.
+func CallWithRetry(client *RpcPool, retry RetryConfig, result any, method string, args ...any) error {
+	return CallWithRetryUnless(client, retry, nil, result, method, args...)
+}
+
+// CallWithRetryUnless is CallWithRetry, except that errors for which final
+// returns true are returned right away, since retrying cannot fix them
+// (e.g. a log query with too many results).
+func CallWithRetryUnless(client *RpcPool, retry RetryConfig, final func(err error) bool, result any, method string, args ...any) error {
+	maxAttempts := retry.maxAttempts()
+
+	var err error
+
+	for attempt := uint64(1); attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(retry.backoff(attempt - 1))
+		}
+
+		if err = client.Call(result, method, args...); err == nil {
+			return nil
+		}
+
+		if final != nil && final(err) {
+			return err
+		}
+
+		log.Printf("%s failed (attempt %d/%d): %v", method, attempt, maxAttempts, err)
+	}
+
+	return fmt.Errorf("%s failed after %d attempts: %w", method, maxAttempts, err)
+}
+
+// SaveFailedRequests writes the failed requests of a scan to a JSON report and logs a summary.
+func SaveFailedRequests(failures []FailedRequest, path string) error {
+	if len(failures) == 0 {
+		return nil
+	}
+
+	if err := SaveStructToJSONFile(failures, path); err != nil {
+		return fmt.Errorf("failed to save failed requests report: %w", err)
+	}
+
+	log.Printf("%d requests failed after all retries, see %s\n", len(failures), path)
+
+	return nil
+}
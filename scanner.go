@@ -1,16 +1,20 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"math/big"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"time"
-	"unsafe"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/schollz/progressbar/v3"
 )
 
@@ -23,10 +27,33 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("from_block must be less or equal to to_block")
 	}
 
+	switch config.Scan.decoder() {
+	case DecoderRpc, DecoderNative:
+	default:
+		return fmt.Errorf("unknown decoder %q", config.Scan.decoder())
+	}
+
 	return nil
 }
 
-func ScanBlocksWithConfig(config *Config) error {
+// matchesAddressFilter reports whether a transaction or call from one address
+// to another involves one of the filter addresses. "ContractCreation" matches
+// every contract creation.
+func matchesAddressFilter(addresses []string, from string, to string, creation bool) bool {
+	for _, address := range addresses {
+		if address == "ContractCreation" && creation {
+			return true
+		}
+
+		if strings.EqualFold(from, address) || strings.EqualFold(to, address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ScanBlocksWithConfig(config *Config, resume bool) error {
 	if err := validateConfig(config); err != nil {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
@@ -47,7 +74,8 @@ func ScanBlocksWithConfig(config *Config) error {
 
 	log.Printf("Total blocks to scan: %d\n", totalBlocks)
 	log.Printf("Batch size: %d\n", batchSize)
-	log.Printf("Delay between requests: %d ms\n", config.Rpc.Delay)
+	log.Printf("Workers: %d\n", config.Rpc.workerCount())
+	log.Printf("Decoder: %s\n", config.Scan.decoder())
 
 	batches := make([][]*big.Int, batchCount)
 
@@ -71,13 +99,105 @@ func ScanBlocksWithConfig(config *Config) error {
 
 	log.Printf("Total batches created: %d\n", len(batches))
 
-	client, err := GetRpcClient(config.Rpc.Url)
+	outputFormat := config.Scan.BlockScanConfig.outputFormat()
+
+	if outputFormat != OutputFormatJSON && outputFormat != OutputFormatJSONL {
+		return fmt.Errorf("unknown output format %q", outputFormat)
+	}
+
+	baseName := fmt.Sprintf("blocks_%d_to_%d", startBlock, endBlock)
+	checkpointPath := fmt.Sprintf("%s/%s.checkpoint.json", config.Scan.OutputDir, baseName)
+
+	// In JSON mode the blocks are streamed to a single partial file which is
+	// turned into the JSON array at the end. In JSONL mode they are streamed
+	// to the rotated output files directly.
+	filePath := fmt.Sprintf("%s/%s.json", config.Scan.OutputDir, baseName)
+	fileName := func(index int) string {
+		return baseName + ".partial.jsonl"
+	}
+	withdrawalsName := fmt.Sprintf("withdrawals_%d_to_%d", startBlock, endBlock)
+	withdrawalsPath := fmt.Sprintf("%s/%s.json", config.Scan.OutputDir, withdrawalsName)
+	withdrawalsStreamPath := fmt.Sprintf("%s/%s.partial.jsonl", config.Scan.OutputDir, withdrawalsName)
+	rotateBlocks, rotateBytes := uint64(0), uint64(0)
+
+	if outputFormat == OutputFormatJSONL {
+		filePath = fmt.Sprintf("%s/%s.manifest.json", config.Scan.OutputDir, baseName)
+		fileName = func(index int) string {
+			return fmt.Sprintf("%s_part%04d.jsonl", baseName, index)
+		}
+		rotateBlocks = config.Scan.BlockScanConfig.RotateBlocks
+		rotateBytes = config.Scan.BlockScanConfig.RotateBytes
+		withdrawalsPath = fmt.Sprintf("%s/%s.jsonl", config.Scan.OutputDir, withdrawalsName)
+		withdrawalsStreamPath = withdrawalsPath
+	}
+
+	checkpoint := newBlockScanCheckpoint(config)
+
+	if resume {
+		loaded, err := LoadBlockScanCheckpoint(checkpointPath)
+		if err != nil {
+			return err
+		}
+
+		if err := loaded.matches(config); err != nil {
+			return fmt.Errorf("cannot resume: %w", err)
+		}
+
+		checkpoint = loaded
+		log.Printf("Resuming from checkpoint %s: %d of %d batches already done\n", checkpointPath, checkpoint.CompletedBatches, batchCount)
+	}
+
+	blockWriter, err := OpenBlockStreamWriter(config.Scan.OutputDir, fileName, rotateBlocks, rotateBytes, checkpoint.Files)
+	if err != nil {
+		return fmt.Errorf("failed to open block output: %w", err)
+	}
+
+	defer blockWriter.Close()
+
+	// Withdrawals are streamed to their own file, next to the blocks.
+	withdrawalWriter, err := OpenJSONLWriter(withdrawalsStreamPath, checkpoint.WithdrawalsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to open withdrawals output: %w", err)
+	}
+
+	defer withdrawalWriter.Close()
+
+	checkpoint.Files = blockWriter.Files()
+
+	// The state as of the last fully handled batch. Only this state is saved,
+	// so that a batch that failed half way is fetched again on resume.
+	completed := *checkpoint
+
+	saveCheckpoint := func() error {
+		if _, err := blockWriter.Sync(); err != nil {
+			return fmt.Errorf("failed to save block output: %w", err)
+		}
+
+		if _, err := withdrawalWriter.Sync(); err != nil {
+			return fmt.Errorf("failed to save withdrawals output: %w", err)
+		}
+
+		completed.UpdatedAt = time.Now().Unix()
+
+		return SaveCheckpoint(&completed, checkpointPath)
+	}
+
+	if err := saveCheckpoint(); err != nil {
+		return err
+	}
+
+	client, err := NewRpcPool(config.Rpc)
 
 	if err != nil {
 		return fmt.Errorf("failed to create RPC client: %w", err)
 	}
 
-	log.Printf("Connected to RPC server: %s\n", config.Rpc.Url)
+	defer client.Close()
+
+	log.Printf("Connected to RPC servers: %s\n", strings.Join(client.Urls(), ", "))
+	log.Printf("Rate limit: %s\n", client.Limiter())
+
+	remainingBatches := batches[checkpoint.CompletedBatches:]
 
 	bar := progressbar.NewOptions64(int64(batchCount),
 		progressbar.OptionSetDescription("Fetching blocks..."),
@@ -85,147 +205,422 @@ func ScanBlocksWithConfig(config *Config) error {
 		progressbar.OptionSetWidth(20),
 	)
 
-	blocks := make([]RpcBlockFull, 0)
+	bar.Set64(int64(checkpoint.CompletedBatches))
 
 	log.Printf("Fetching blocks from %d to %d in batches of %d\n", startBlock, endBlock, batchSize)
 
-	txCount := 0
-	failedBlockCount := 0
-	successfulBlockCount := 0
+	type blocksBatchResult struct {
+		blocks   []RpcBlockFull
+		failures []FailedRequest
+		missing  []uint64
+	}
+
+	sizer := NewAdaptiveBatchSize(batchSize)
+	checkpointInterval := config.Scan.BlockScanConfig.checkpointInterval()
 
-	for _, batch := range batches {
-		if len(batch) == 0 {
-			continue
+	// The address filter is applied to the converted blocks, so that it works the same with both decoders.
+	convertBlock := RpcBlockFullToBlockFull
+	if config.Scan.decoder() == DecoderNative {
+		convertBlock = func(block *RpcBlockFull) (*BlockFull, error) {
+			return NativeBlockToBlockFull(block.Raw)
 		}
+	}
 
-		bar.Describe(fmt.Sprintf("Txs: %d, Success (Block): %d Fail (Block): %d", txCount, successfulBlockCount, failedBlockCount))
+	fetchBatch := func(i int) blocksBatchResult {
+		if len(remainingBatches[i]) == 0 {
+			return blocksBatchResult{}
+		}
 
-		batchBlocks, err := GetBlocksBatch(client, batch)
+		batchBlocks, batchFailures, batchMissing := FetchBlocksComplete(client, remainingBatches[i], config.Rpc.Retry, sizer, config.Scan.BlockScanConfig.gapRetries())
 
-		// Add a delay between requests
-		time.Sleep(time.Duration(config.Rpc.Delay) * time.Millisecond)
+		return blocksBatchResult{blocks: batchBlocks, failures: batchFailures, missing: batchMissing}
+	}
 
-		if err != nil {
-			bar.Add(1)
-			failedBlockCount += len(batch)
-			return fmt.Errorf("failed to fetch blocks: %w", err)
-		}
+	handleBatch := func(i int, result blocksBatchResult) error {
+		batchBlocks, batchFailures := result.blocks, result.failures
 
-		for _, block := range batchBlocks {
-			transactions := block.Transactions
+		checkpoint.Failures = append(checkpoint.Failures, batchFailures...)
+		checkpoint.MissingBlocks = append(checkpoint.MissingBlocks, result.missing...)
 
-			if len(config.Filter.Addresses) > 0 {
-				filteredTransactions := make([]RpcTransactionFull, 0)
+		for _, block := range batchBlocks {
+			blockData, err := convertBlock(&block)
 
-				for _, tx := range transactions {
-					fromLower := strings.ToLower(tx.From)
-					toLower := strings.ToLower(tx.To)
+			if err != nil {
+				return fmt.Errorf("failed to convert block %s: %w", block.Number, err)
+			}
 
-					for _, address := range config.Filter.Addresses {
-						addressLower := strings.ToLower(address)
+			// Blocks are verified before the address filter removes some of their transactions.
+			if checkpoint.VerifyBlocks {
+				checkpoint.Verification.BlockMismatches = append(checkpoint.Verification.BlockMismatches, VerifyBlock(blockData, nil)...)
+				checkpoint.Verification.VerifiedBlocks++
+			}
 
-						if address == "ContractCreation" && tx.To == "" {
-							filteredTransactions = append(filteredTransactions, tx)
-							break
-						}
+			if len(config.Filter.Addresses) > 0 {
+				filteredTransactions := make([]TransactionFull, 0)
 
-						if fromLower == addressLower || toLower == addressLower {
-							filteredTransactions = append(filteredTransactions, tx)
-							break
+				for _, tx := range blockData.Transactions {
+					if matchesAddressFilter(config.Filter.Addresses, tx.From, tx.To, tx.To == "") {
+						filteredTransactions = append(filteredTransactions, tx)
+					}
+				}
+				blockData.Transactions = filteredTransactions
+
+				// Withdrawals are kept when their recipient is one of the addresses
+				if blockData.Withdrawals != nil {
+					filteredWithdrawals := make([]Withdrawal, 0)
+
+					for _, withdrawal := range blockData.Withdrawals {
+						for _, address := range config.Filter.Addresses {
+							if strings.EqualFold(withdrawal.Address, address) {
+								filteredWithdrawals = append(filteredWithdrawals, withdrawal)
+								break
+							}
 						}
-
 					}
 
+					blockData.Withdrawals = filteredWithdrawals
 				}
-				block.Transactions = filteredTransactions
+			}
 
+			if checkpoint.VerifyTransactions {
+				for _, tx := range blockData.Transactions {
+					checkpoint.Verification.TransactionMismatches = append(checkpoint.Verification.TransactionMismatches, VerifyTransaction(&tx)...)
+				}
+
+				checkpoint.Verification.VerifiedTransactions += len(blockData.Transactions)
+			}
+
+			if err := blockWriter.WriteBlock(blockData); err != nil {
+				return fmt.Errorf("failed to save block: %w", err)
 			}
 
-			txCount += len(block.Transactions)
+			for _, withdrawal := range blockData.Withdrawals {
+				record := BlockWithdrawal{BlockNumber: blockData.Number, BlockHash: blockData.Hash, Withdrawal: withdrawal}
+
+				if err := withdrawalWriter.Write(record); err != nil {
+					return fmt.Errorf("failed to save withdrawal: %w", err)
+				}
+			}
 
-			successfulBlockCount++
-			blocks = append(blocks, block)
+			checkpoint.TxCount += len(blockData.Transactions)
+			checkpoint.WithdrawalCount += len(blockData.Withdrawals)
+			checkpoint.BlockCount++
+		}
+
+		checkpoint.CompletedBatches++
+		checkpoint.Files = blockWriter.Files()
+		checkpoint.WithdrawalsBytes = withdrawalWriter.Offset()
+		completed = *checkpoint
+
+		if checkpoint.CompletedBatches%checkpointInterval == 0 {
+			if err := saveCheckpoint(); err != nil {
+				return err
+			}
 		}
 
+		bar.Describe(fmt.Sprintf("Txs: %d, Success (Block): %d Fail (Block): %d Batch: %d", checkpoint.TxCount, checkpoint.BlockCount, len(checkpoint.MissingBlocks), sizer.Size()))
 		bar.Add(1)
 
+		return nil
+	}
+
+	if err := RunBatches(len(remainingBatches), config.Rpc.workerCount(), fetchBatch, handleBatch); err != nil {
+		if checkpointErr := saveCheckpoint(); checkpointErr != nil {
+			log.Printf("failed to save checkpoint: %v", checkpointErr)
+		}
+		return err
+	}
+
+	if err := saveCheckpoint(); err != nil {
+		return err
+	}
+
+	if err := blockWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close block output: %w", err)
+	}
+
+	if err := withdrawalWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close withdrawals output: %w", err)
 	}
 
-	if len(blocks) == 0 {
+	if checkpoint.BlockCount == 0 {
 		return fmt.Errorf("no blocks fetched")
 	}
 
-	outBlocks := make([]*BlockFull, len(blocks))
+	switch outputFormat {
+	case OutputFormatJSON:
+		partialPath := fmt.Sprintf("%s/%s", config.Scan.OutputDir, checkpoint.Files[0].File)
 
-	for i, block := range blocks {
-		blockData, err := RpcBlockFullToBlockFull(&block)
+		if err := WriteJSONArrayFromJSONL[*BlockFull](partialPath, filePath); err != nil {
+			return fmt.Errorf("failed to save blocks to file: %w", err)
+		}
 
-		if err != nil {
-			return fmt.Errorf("failed to convert block data: %w", err)
+		if checkpoint.WithdrawalCount > 0 {
+			if err := WriteJSONArrayFromJSONL[*BlockWithdrawal](withdrawalsStreamPath, withdrawalsPath); err != nil {
+				return fmt.Errorf("failed to save withdrawals to file: %w", err)
+			}
+		}
+	case OutputFormatJSONL:
+		manifest := NewBlockManifest(startBlock, endBlock, checkpoint.Files)
+		if checkpoint.WithdrawalCount > 0 {
+			manifest.Withdrawals = filepath.Base(withdrawalsPath)
 		}
 
-		outBlocks[i] = blockData
+		if err := SaveStructToJSONFile(manifest, filePath); err != nil {
+			return fmt.Errorf("failed to save block manifest: %w", err)
+		}
 	}
 
-	filePath := fmt.Sprintf("%s/blocks_%d_to_%d.json", config.Scan.OutputDir, startBlock, endBlock)
+	failuresPath := fmt.Sprintf("%s/failed_blocks_%d_to_%d.json", config.Scan.OutputDir, startBlock, endBlock)
 
-	if err := SaveStructToJSONFile(outBlocks, filePath); err != nil {
-		return fmt.Errorf("failed to save blocks to file: %w", err)
+	if err := SaveFailedRequests(checkpoint.Failures, failuresPath); err != nil {
+		return err
 	}
 
-	log.Printf("\nTask completed successfully!\n")
-	log.Printf("Blocks fetched and saved to %s.\n", filePath)
+	// The final output is complete, the checkpoint and partial output are no longer needed
+	if outputFormat == OutputFormatJSON {
+		os.Remove(fmt.Sprintf("%s/%s", config.Scan.OutputDir, checkpoint.Files[0].File))
+	}
+	if outputFormat == OutputFormatJSON || checkpoint.WithdrawalCount == 0 {
+		os.Remove(withdrawalsStreamPath)
+	}
+	os.Remove(checkpointPath)
 
 	bar.Finish()
+
+	verificationPath := fmt.Sprintf("%s/verification_%d_to_%d.json", config.Scan.OutputDir, startBlock, endBlock)
+
+	if checkpoint.VerifyBlocks || checkpoint.VerifyTransactions {
+		report := &checkpoint.Verification
+
+		if err := SaveStructToJSONFile(report, verificationPath); err != nil {
+			return fmt.Errorf("failed to save verification report: %w", err)
+		}
+
+		log.Printf("Verified %d blocks and %d transactions: %d block mismatches, %d transaction mismatches, see %s\n",
+			report.VerifiedBlocks, report.VerifiedTransactions, len(report.BlockMismatches), len(report.TransactionMismatches), verificationPath)
+	}
+
+	// The chain is checked on the saved output, which is complete at this point
+	var chainErr error
+	if config.Scan.BlockScanConfig.CheckChain {
+		chainErr = CheckChainWithConfig(config, []string{filePath})
+	}
+
+	if len(checkpoint.MissingBlocks) > 0 {
+		gapsPath := fmt.Sprintf("%s/gaps_%d_to_%d.json", config.Scan.OutputDir, startBlock, endBlock)
+		report := NewGapsReport(startBlock, endBlock, checkpoint.MissingBlocks)
+
+		if err := SaveStructToJSONFile(report, gapsPath); err != nil {
+			return fmt.Errorf("failed to save gaps report: %w", err)
+		}
+
+		return fmt.Errorf("output %s is incomplete: %d blocks missing in %d gaps, see %s",
+			filePath, report.MissingBlocks, len(report.Gaps), gapsPath)
+	}
+
+	if chainErr != nil {
+		return chainErr
+	}
+
+	if checkpoint.Verification.Mismatches() > 0 {
+		return fmt.Errorf("output %s has %d fields that do not match the recomputed values, see %s",
+			filePath, checkpoint.Verification.Mismatches(), verificationPath)
+	}
+
+	log.Printf("\nTask completed successfully!\n")
+	log.Printf("Blocks fetched and saved to %s.\n", filePath)
+	if checkpoint.WithdrawalCount > 0 {
+		log.Printf("%d withdrawals saved to %s.\n", checkpoint.WithdrawalCount, withdrawalsPath)
+	}
 	return nil
 }
 
-func ScanReceiptsWithConfig(config *Config, blockFile string) error {
-	var blocks []*BlockFull
+const (
+	ReceiptMethodAuto        = "auto"        // eth_getBlockReceipts when the node supports it, eth_getTransactionReceipt otherwise
+	ReceiptMethodBlock       = "block"       // One eth_getBlockReceipts call per block
+	ReceiptMethodTransaction = "transaction" // One eth_getTransactionReceipt call per transaction
+)
 
-	err := JSONToStruct(blockFile, &blocks)
+// method returns the configured way of fetching receipts, falling back to the default.
+func (r ReceiptScanConfig) method() string {
+	if r.Method == "" {
+		return DefaultReceiptMethod
+	}
 
-	if err != nil {
-		return fmt.Errorf("failed to load blocks from file: %w", err)
+	return r.Method
+}
+
+// batchSize returns the configured number of blocks per batch, falling back to the default.
+func (r ReceiptScanConfig) batchSize() uint64 {
+	if r.BatchSize == 0 {
+		return DefaultReceiptBatchSize
 	}
 
-	transactions := make([]string, 0)
+	return r.BatchSize
+}
+
+// receiptBlock is a block whose receipts are scanned. Blocks from a block file
+// are identified by hash and list their transactions, blocks of a range are
+// identified by number and their transactions are not known in advance.
+type receiptBlock struct {
+	id           string
+	number       *big.Int
+	transactions []string
+}
+
+// compareRpcReceipts orders receipts by block number, then by transaction index.
+// Invalid numbers are left in place, the conversion reports them.
+func compareRpcReceipts(a RpcReceipt, b RpcReceipt) int {
+	for _, pair := range [][2]string{{a.BlockNumber, b.BlockNumber}, {a.TransactionIndex, b.TransactionIndex}} {
+		x, errX := parseHexQuantity(pair[0])
+		y, errY := parseHexQuantity(pair[1])
 
-	for _, block := range blocks {
-		if block == nil {
-			continue
+		if errX != nil || errY != nil {
+			return 0
 		}
 
-		for _, tx := range block.Transactions {
-			transactions = append(transactions, tx.Hash)
+		if c := x.Cmp(y); c != 0 {
+			return c
 		}
 	}
 
+	return 0
+}
+
+// ScanReceiptsWithConfig fetches the receipts of the blocks of a block file
+// (JSON file or JSON lines manifest), or of the block range of the
+// configuration when blockFile is empty. The receipts are streamed to a
+// partial JSON lines file, turned into the JSON array output at the end.
+func ScanReceiptsWithConfig(config *Config, blockFile string, resume bool) error {
 	if err := validateConfig(config); err != nil {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
+	receiptMethod := config.Scan.ReceiptScanConfig.method()
+
+	switch receiptMethod {
+	case ReceiptMethodAuto, ReceiptMethodBlock, ReceiptMethodTransaction:
+	default:
+		return fmt.Errorf("invalid configuration: unknown receipt method %q", receiptMethod)
+	}
+
+	blocks := make([]receiptBlock, 0)
+	totalTransactions := 0
+
+	if blockFile != "" {
+		err := ReadBlocks(blockFile, func(block *BlockFull) error {
+			transactions := make([]string, len(block.Transactions))
+
+			for i, tx := range block.Transactions {
+				transactions[i] = tx.Hash
+			}
+
+			blocks = append(blocks, receiptBlock{id: block.Hash, number: block.Number, transactions: transactions})
+			totalTransactions += len(transactions)
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+	} else {
+		for number := config.Scan.FromBlock; number <= config.Scan.ToBlock; number++ {
+			blockNumber := new(big.Int).SetUint64(number)
+			blocks = append(blocks, receiptBlock{id: BigIntToHex(blockNumber), number: blockNumber})
+		}
+	}
+
 	log.Printf("Starting the receipt scanner...\n")
 
-	client, err := GetRpcClient(config.Rpc.Url)
+	batchSize := config.Scan.ReceiptScanConfig.batchSize()
+	totalBlocks := uint64(len(blocks))
+	batchCount := totalBlocks / batchSize
+
+	if totalBlocks%batchSize != 0 {
+		batchCount++
+	}
+
+	baseName := fmt.Sprintf("receipts_%d_to_%d", config.Scan.FromBlock, config.Scan.ToBlock)
+	filePath := fmt.Sprintf("%s/%s.json", config.Scan.OutputDir, baseName)
+	partialPath := fmt.Sprintf("%s/%s.partial.jsonl", config.Scan.OutputDir, baseName)
+	checkpointPath := fmt.Sprintf("%s/%s.checkpoint.json", config.Scan.OutputDir, baseName)
+
+	checkpoint := newReceiptScanCheckpoint(config, blockFile)
+
+	if resume {
+		loaded, err := LoadReceiptScanCheckpoint(checkpointPath)
+		if err != nil {
+			return err
+		}
+
+		if err := loaded.matches(config, blockFile); err != nil {
+			return fmt.Errorf("cannot resume: %w", err)
+		}
+
+		checkpoint = loaded
+		log.Printf("Resuming from checkpoint %s: %d of %d batches already done\n", checkpointPath, checkpoint.CompletedBatches, batchCount)
+	}
+
+	writer, err := OpenJSONLWriter(partialPath, checkpoint.OutputBytes)
+	if err != nil {
+		return fmt.Errorf("failed to open receipts output: %w", err)
+	}
+
+	defer writer.Close()
+
+	// The state as of the last fully handled batch. Only this state is saved,
+	// so that a batch that failed half way is fetched again on resume.
+	completed := *checkpoint
+
+	saveCheckpoint := func() error {
+		if _, err := writer.Sync(); err != nil {
+			return fmt.Errorf("failed to save receipts output: %w", err)
+		}
+
+		completed.UpdatedAt = time.Now().Unix()
+
+		return SaveCheckpoint(&completed, checkpointPath)
+	}
+
+	if err := saveCheckpoint(); err != nil {
+		return err
+	}
+
+	client, err := NewRpcPool(config.Rpc)
 
 	if err != nil {
 		return fmt.Errorf("failed to create RPC client: %w", err)
 	}
 
-	log.Printf("Connected to RPC server: %s\n", config.Rpc.Url)
+	defer client.Close()
 
-	batchSize := config.Scan.ReceiptScanConfig.BatchSize
-	totalTransactions := uint64(len(transactions))
-	batchCount := totalTransactions / batchSize
+	log.Printf("Connected to RPC servers: %s\n", strings.Join(client.Urls(), ", "))
+	log.Printf("Rate limit: %s\n", client.Limiter())
 
-	if totalTransactions%batchSize != 0 {
-		batchCount++
+	if receiptMethod == ReceiptMethodAuto && len(blocks) > 0 {
+		supported, err := SupportsBlockReceipts(client, blocks[0].id, config.Rpc.Retry)
+		if err != nil {
+			return err
+		}
+
+		receiptMethod = ReceiptMethodTransaction
+		if supported {
+			receiptMethod = ReceiptMethodBlock
+		}
 	}
 
-	log.Printf("Total transactions to scan: %d\n", totalTransactions)
+	if blockFile != "" {
+		log.Printf("Total blocks to scan: %d (%d transactions)\n", totalBlocks, totalTransactions)
+	} else {
+		log.Printf("Total blocks to scan: %d\n", totalBlocks)
+	}
 
-	log.Printf("Batch size: %d\n", batchSize)
+	log.Printf("Receipt method: %s\n", receiptMethod)
+	log.Printf("Batch size: %d blocks\n", batchSize)
+	log.Printf("Workers: %d\n", config.Rpc.workerCount())
+	log.Printf("Decoder: %s\n", config.Scan.decoder())
 
 	bar := progressbar.NewOptions64(int64(batchCount),
 		progressbar.OptionSetDescription("Fetching receipts..."),
@@ -233,57 +628,228 @@ func ScanReceiptsWithConfig(config *Config, blockFile string) error {
 		progressbar.OptionSetWidth(20),
 	)
 
-	receipts := make([]Receipt, 0)
+	bar.Set64(int64(checkpoint.CompletedBatches))
 
-	for i := uint64(0); i < batchCount; i++ {
-		batchStart := i * batchSize
+	// Batches are numbered from the first batch not done yet
+	firstBatch := checkpoint.CompletedBatches
+	checkpointInterval := config.Scan.BlockScanConfig.checkpointInterval()
+
+	type receiptsBatchResult struct {
+		receipts []RpcReceipt
+		failures []FailedRequest
+	}
+
+	batchBounds := func(i int) (uint64, uint64) {
+		batchStart := (firstBatch + uint64(i)) * batchSize
 		batchEnd := batchStart + batchSize
 
-		if batchEnd > totalTransactions {
-			batchEnd = totalTransactions
+		if batchEnd > totalBlocks {
+			batchEnd = totalBlocks
+		}
+
+		return batchStart, batchEnd
+	}
+
+	sizer := NewAdaptiveBatchSize(batchSize)
+
+	convertReceipt := RpcReceiptToReceipt
+	if config.Scan.decoder() == DecoderNative {
+		convertReceipt = func(receipt *RpcReceipt) (*Receipt, error) {
+			return NativeReceiptToReceipt(receipt.Raw)
 		}
+	}
 
-		currentBatch := transactions[batchStart:batchEnd]
+	// fetchTransactionReceipts fetches one receipt per transaction. The
+	// transactions of blocks from a range are read from the blocks first.
+	fetchTransactionReceipts := func(batchBlocks []receiptBlock) receiptsBatchResult {
+		transactions := make([]string, 0)
+		failures := make([]FailedRequest, 0)
 
-		bar.Describe(fmt.Sprintf("Fetching receipts for transactions %d to %d", batchStart, batchEnd))
+		if blockFile != "" {
+			for _, block := range batchBlocks {
+				transactions = append(transactions, block.transactions...)
+			}
+		} else {
+			numbers := make([]*big.Int, len(batchBlocks))
 
-		batchReceipts, err := GetReceiptsBatch(client, currentBatch)
-		// Add a delay between requests
-		time.Sleep(time.Duration(config.Rpc.Delay) * time.Millisecond)
+			for j, block := range batchBlocks {
+				numbers[j] = block.number
+			}
 
-		if err != nil {
-			bar.Add(1)
-			return fmt.Errorf("failed to fetch receipts: %w", err)
+			rpcBlocks, blockFailures := GetBlocksBatch(client, numbers, config.Rpc.Retry, sizer)
+			failures = append(failures, blockFailures...)
+
+			for _, rpcBlock := range rpcBlocks {
+				for _, tx := range rpcBlock.Transactions {
+					transactions = append(transactions, tx.Hash)
+				}
+			}
+		}
+
+		if len(transactions) == 0 {
+			return receiptsBatchResult{failures: failures}
 		}
 
-		for _, receipt := range batchReceipts {
-			receiptData, err := RpcReceiptToReceipt(&receipt)
+		batchReceipts, receiptFailures := GetReceiptsBatch(client, transactions, config.Rpc.Retry, sizer)
+
+		return receiptsBatchResult{receipts: batchReceipts, failures: append(failures, receiptFailures...)}
+	}
+
+	// fetchBlockReceipts fetches whole blocks. For blocks from a file, only the
+	// receipts of the listed transactions are kept, so that a block file written
+	// with an address filter gives the same receipts as per-transaction calls.
+	fetchBlockReceipts := func(batchBlocks []receiptBlock) receiptsBatchResult {
+		ids := make([]string, 0, len(batchBlocks))
+		listed := make(map[string]bool)
+
+		for _, block := range batchBlocks {
+			if block.transactions != nil && len(block.transactions) == 0 {
+				continue
+			}
+
+			ids = append(ids, block.id)
+
+			for _, hash := range block.transactions {
+				listed[strings.ToLower(hash)] = true
+			}
+		}
+
+		if len(ids) == 0 {
+			return receiptsBatchResult{}
+		}
+
+		batchReceipts, batchFailures := GetBlockReceiptsBatch(client, ids, config.Rpc.Retry, sizer)
+
+		if blockFile != "" {
+			batchReceipts = slices.DeleteFunc(batchReceipts, func(receipt RpcReceipt) bool {
+				return !listed[strings.ToLower(receipt.TransactionHash)]
+			})
+		}
+
+		// The probe only checks the first block: blocks that a node behind the
+		// endpoint cannot serve with eth_getBlockReceipts are fetched per transaction.
+		unsupported := make([]receiptBlock, 0)
+		failures := make([]FailedRequest, 0, len(batchFailures))
+
+		for _, failure := range batchFailures {
+			if isMethodNotFoundError(errors.New(failure.Error)) && len(failure.Args) == 1 {
+				index := slices.IndexFunc(batchBlocks, func(block receiptBlock) bool {
+					return failure.Args[0] == block.id
+				})
+
+				if index >= 0 {
+					unsupported = append(unsupported, batchBlocks[index])
+					continue
+				}
+			}
+
+			failures = append(failures, failure)
+		}
+
+		if len(unsupported) > 0 {
+			log.Printf("eth_getBlockReceipts is not available for %d blocks, fetching their receipts per transaction\n", len(unsupported))
+
+			fallback := fetchTransactionReceipts(unsupported)
+			batchReceipts = append(batchReceipts, fallback.receipts...)
+			failures = append(failures, fallback.failures...)
+
+			// Keep the receipts in block order
+			slices.SortStableFunc(batchReceipts, compareRpcReceipts)
+		}
+
+		return receiptsBatchResult{receipts: batchReceipts, failures: failures}
+	}
+
+	fetchBatch := func(i int) receiptsBatchResult {
+		batchStart, batchEnd := batchBounds(i)
+
+		if receiptMethod == ReceiptMethodBlock {
+			return fetchBlockReceipts(blocks[batchStart:batchEnd])
+		}
+
+		return fetchTransactionReceipts(blocks[batchStart:batchEnd])
+	}
+
+	handleBatch := func(i int, result receiptsBatchResult) error {
+		batchStart, batchEnd := batchBounds(i)
+
+		bar.Describe(fmt.Sprintf("Fetched receipts for blocks %s to %s (batch: %d)", blocks[batchStart].number, blocks[batchEnd-1].number, sizer.Size()))
+
+		checkpoint.Failures = append(checkpoint.Failures, result.failures...)
+
+		for _, receipt := range result.receipts {
+			receiptData, err := convertReceipt(&receipt)
 
 			if err != nil {
 				bar.Add(1)
-				return fmt.Errorf("failed to convert receipt data: %w", err)
+				return fmt.Errorf("failed to convert receipt %s: %w", receipt.TransactionHash, err)
+			}
+
+			if err := writer.Write(receiptData); err != nil {
+				return fmt.Errorf("failed to save receipt: %w", err)
 			}
 
-			receipts = append(receipts, *receiptData)
+			checkpoint.ReceiptCount++
+		}
+
+		checkpoint.BlockCount += batchEnd - batchStart
+		checkpoint.CompletedBatches++
+		checkpoint.OutputBytes = writer.Offset()
+		completed = *checkpoint
+
+		if checkpoint.CompletedBatches%checkpointInterval == 0 {
+			if err := saveCheckpoint(); err != nil {
+				return err
+			}
 		}
 
 		bar.Add(1)
+
+		return nil
 	}
 
-	if len(receipts) == 0 {
-		return fmt.Errorf("no receipts fetched")
+	if err := RunBatches(int(batchCount-firstBatch), config.Rpc.workerCount(), fetchBatch, handleBatch); err != nil {
+		if checkpointErr := saveCheckpoint(); checkpointErr != nil {
+			log.Printf("failed to save checkpoint: %v", checkpointErr)
+		}
+		return err
 	}
 
-	filePath := fmt.Sprintf("%s/receipts_%d_to_%d.json", config.Scan.OutputDir, config.Scan.FromBlock, config.Scan.ToBlock)
+	if err := saveCheckpoint(); err != nil {
+		return err
+	}
 
-	if err := SaveStructToJSONFile(receipts, filePath); err != nil {
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to close receipts output: %w", err)
+	}
+
+	if checkpoint.ReceiptCount == 0 {
+		return fmt.Errorf("no receipts fetched")
+	}
+
+	if err := WriteJSONArrayFromJSONL[*Receipt](partialPath, filePath); err != nil {
 		return fmt.Errorf("failed to save receipts to file: %w", err)
 	}
 
-	log.Printf("\nTask completed successfully!\n")
-	log.Printf("Receipts fetched and saved to %s.\n", filePath)
+	failuresPath := fmt.Sprintf("%s/failed_receipts_%d_to_%d.json", config.Scan.OutputDir, config.Scan.FromBlock, config.Scan.ToBlock)
+
+	if err := SaveFailedRequests(checkpoint.Failures, failuresPath); err != nil {
+		return err
+	}
+
+	// The final output is complete, the checkpoint and partial output are no longer needed
+	os.Remove(partialPath)
+	os.Remove(checkpointPath)
+
 	bar.Finish()
 
+	log.Printf("\nTask completed successfully!\n")
+	log.Printf("%d receipts of %d blocks saved to %s.\n", checkpoint.ReceiptCount, checkpoint.BlockCount, filePath)
+
+	if len(checkpoint.Failures) > 0 {
+		return fmt.Errorf("output %s is incomplete: %d requests failed, see %s", filePath, len(checkpoint.Failures), failuresPath)
+	}
+
 	return nil
 }
 
@@ -296,7 +862,8 @@ type RpcAccount struct {
 	Nonce      uint64 `json:"nonce"`
 	Root       string `json:"root"`
 	CodeHash   string `json:"codeHash"`
-	IsContract bool   `json:"isContract"`
+	Key        string `json:"key,omitempty"` // Hashed address (trie key), when returned by the node
+	IsContract bool   `json:"isContract"`    // Has code, which includes EOAs with an EIP-7702 delegation
 }
 
 type RpcAccountPageResult struct {
@@ -305,24 +872,60 @@ type RpcAccountPageResult struct {
 	Next     string                `json:"next"`
 }
 
-func ScanAllAccounts(config *Config) error {
+// AccountRecord is a single line of the account scan output.
+type AccountRecord struct {
+	Address string `json:"address"`
+	RpcAccount
+}
+
+// sortedAccountRecords returns the accounts of a page ordered by trie key, which
+// is the order in which debug_accountRange walks the state.
+func sortedAccountRecords(accounts map[string]RpcAccount) []AccountRecord {
+	records := make([]AccountRecord, 0, len(accounts))
+
+	for address, account := range accounts {
+		if account.Key == "" && common.IsHexAddress(address) {
+			account.Key = crypto.Keccak256Hash(common.HexToAddress(address).Bytes()).Hex()
+		}
+
+		records = append(records, AccountRecord{Address: address, RpcAccount: account})
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Key != records[j].Key {
+			return records[i].Key < records[j].Key
+		}
+		return records[i].Address < records[j].Address
+	})
+
+	return records
+}
+
+func ScanAllAccounts(config *Config, resume bool) error {
 	if err := validateConfig(config); err != nil {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
 	log.Printf("Starting the account scanner...\n")
 
-	client, err := GetRpcClient(config.Rpc.Url)
+	filter, err := NewAccountFilter(config)
+	if err != nil {
+		return fmt.Errorf("invalid account filter: %w", err)
+	}
+
+	client, err := NewRpcPool(config.Rpc)
 	if err != nil {
 		return fmt.Errorf("failed to create RPC client: %w", err)
 	}
-	log.Printf("Connected to RPC server: %s\n", config.Rpc.Url)
+
+	defer client.Close()
+	log.Printf("Connected to RPC servers: %s\n", strings.Join(client.Urls(), ", "))
 
 	batchSize := config.Scan.AccountScanConfig.BatchSize
-	scanKey := config.Scan.AccountScanConfig.StartKey
 	blockNumber := config.Scan.AccountScanConfig.BlockNumber
 	maxAccounts := config.Scan.AccountScanConfig.MaxAccounts
-	baseOutputFileName := config.Scan.AccountScanConfig.OutputFileName
+	baseOutputFileName := strings.TrimSuffix(config.Scan.AccountScanConfig.OutputFileName, filepath.Ext(config.Scan.AccountScanConfig.OutputFileName))
+	filePath := fmt.Sprintf("%s/%s.jsonl", config.Scan.OutputDir, baseOutputFileName)
 
 	if maxAccounts == 0 {
 		maxAccounts = math.MaxUint64
@@ -330,216 +933,99 @@ func ScanAllAccounts(config *Config) error {
 
 	log.Printf("Batch size: %d\n", batchSize)
 	log.Printf("Max accounts: %d\n", maxAccounts)
-	log.Printf("Start key: %s\n", scanKey)
+	log.Printf("Start key: %s\n", config.Scan.AccountScanConfig.StartKey)
 	log.Printf("Block number: %d\n", blockNumber)
-	log.Printf("Output file name: %s\n", baseOutputFileName)
-	log.Printf("Delay between requests: %d ms\n", config.Rpc.Delay)
+	log.Printf("Partitions: %d\n", config.Scan.AccountScanConfig.partitionCount())
+	log.Printf("Account filter: %s\n", filter)
+	log.Printf("Output file: %s\n", filePath)
+	log.Printf("Rate limit: %s\n", client.Limiter())
 	log.Printf("Starting the account scan...\n")
 
-	// Our in-memory store for accounts.
-	accounts := make(map[string]RpcAccount)
-	nonContractCodeHash := "0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"
-	numContracts := 0
-	numNonContracts := 0
-	numContractsWithBalance := 0
-
-	// Set up flush threshold and a slice to track chunk files.
-	const flushThresholdBytes = 10 * 1024 * 1024 // 10 MB
-	chunkFiles := []string{}
-
-	// flushAccounts flushes the current accounts map to disk and resets it.
-	flushAccounts := func() error {
-		chunkFileName := fmt.Sprintf("%s_%d.json", baseOutputFileName, len(chunkFiles)+1)
-		filePath := fmt.Sprintf("%s/%s", config.Scan.OutputDir, chunkFileName)
-		if err := SaveStructToJSONFile(accounts, filePath); err != nil {
-			return fmt.Errorf("failed to save accounts chunk to file: %w", err)
-		}
-		memoryUsageMB := (len(accounts) * int(unsafe.Sizeof(RpcAccount{}))) / (1024 * 1024)
-		log.Printf("Flushed %d accounts (approx %d MB) to file: %s\n", len(accounts), memoryUsageMB, filePath)
-		chunkFiles = append(chunkFiles, filePath)
-		// Reset the in-memory store.
-		accounts = make(map[string]RpcAccount)
-		return nil
-	}
-
-	totalAccounts := 0
+	checkpointPath := fmt.Sprintf("%s/%s.checkpoint.json", config.Scan.OutputDir, baseOutputFileName)
 
-	latestAccount := &RpcAccount{
-		Balance:    "0",
-		Nonce:      0,
-		Root:       "",
-		CodeHash:   "",
-		IsContract: false,
+	checkpoint, err := newAccountScanCheckpoint(config, baseOutputFileName)
+	if err != nil {
+		return err
 	}
 
-	latestAddress := "0x"
-
-	iters := 0
-
-	lastTime := time.Now()
-
-	lastAccountCount := 1
-
-	seenAccounts := make(map[string]bool)
-
-	// Main scanning loop.
-	for {
-		iters++
-		if uint64(len(accounts)) >= maxAccounts {
-			log.Printf("Reached the maximum number of accounts to scan: %d\n", maxAccounts)
-			break
-		}
-
-		var raw json.RawMessage
-		err = client.Call(&raw, "debug_accountRange", blockNumber, scanKey, batchSize, true, true)
+	if resume {
+		loaded, err := LoadAccountScanCheckpoint(checkpointPath)
 		if err != nil {
-			return fmt.Errorf("failed to fetch accounts: %w", err)
+			return err
 		}
 
-		// Delay between requests.
-		time.Sleep(time.Duration(config.Rpc.Delay) * time.Millisecond)
-
-		var result RpcAccountPageResult
-		if err := json.Unmarshal(raw, &result); err != nil {
-			return fmt.Errorf("failed to unmarshal JSON: %w", err)
+		if err := loaded.matches(config); err != nil {
+			return fmt.Errorf("cannot resume: %w", err)
 		}
 
-		// Update the scan key.
-		newKey := result.Next
-		scanKey = newKey
-
-		completedScan := false
-
-		// Process each account in the batch.
-		for address, account := range result.Accounts {
-			if seenAccounts[address] {
-				log.Printf("Completely scanned all accounts !\n")
-				completedScan = true
-				break
-			}
-
-			seenAccounts[address] = true
-
-			if uint64(len(seenAccounts)) >= maxAccounts {
-				log.Printf("Reached the maximum number of accounts to scan: %d !\n", maxAccounts)
-				completedScan = true
-				break
-			}
-
-			if account.CodeHash == nonContractCodeHash {
-				numNonContracts++
-				account.IsContract = false
-			} else {
-				numContracts++
-				account.IsContract = true
-				if account.Balance != "0" {
-					numContractsWithBalance++
-
-					accounts[address] = account
-
-					latestAccount = &account
-					latestAddress = address
-				}
+		checkpoint = loaded
+		totals := checkpoint.totals()
+		log.Printf("Resuming from checkpoint %s: %d accounts scanned in %d pages\n", checkpointPath, totals.ScannedAccounts, totals.Pages)
+	}
 
-			}
+	if err := SaveCheckpoint(checkpoint, checkpointPath); err != nil {
+		return err
+	}
 
-		}
+	// Each partition streams its accounts to its own JSON lines file, in trie
+	// key order. The files are merged into a single file once all are done.
+	scan := &accountRangeScan{
+		client:         client,
+		config:         config,
+		filter:         filter,
+		maxAccounts:    maxAccounts,
+		checkpoint:     checkpoint,
+		checkpointPath: checkpointPath,
+	}
 
-		if completedScan {
-			log.Printf("Completed scan!\n")
-			break
-		}
+	if err := scan.run(); err != nil {
+		return err
+	}
 
-		if iters%20 == 0 {
-			log.Printf("===========================================\n")
+	// A scan stopped by the maximum number of accounts keeps its checkpoint
+	// and partition files, so that it can be resumed with a higher maximum.
+	partial := scan.stopped.Load()
 
-			log.Printf("Total: %d accounts (%d contracts, %d non-contracts, %d contracts with balance)\n",
-				len(accounts), numContracts, numNonContracts, numContractsWithBalance)
-			log.Printf("===========================================\n")
-			scanKeyBigInt, _ := Base64ToBigInt(scanKey)
-			log.Printf("Current scan key: %s (%d)\n", scanKey, scanKeyBigInt)
-			log.Printf("===========================================\n")
-			log.Printf("Latest account item: \n")
-			log.Printf("Address: %s\n", latestAddress)
-			log.Printf("Balance: %s\n", latestAccount.Balance)
-			log.Printf("Nonce: %d\n", latestAccount.Nonce)
-			log.Printf("===========================================\n")
-			log.Printf("Time elapsed: %s\n", time.Since(lastTime))
+	if err := mergeAccountPartitions(config.Scan.OutputDir, checkpoint.Partitions, filePath, partial); err != nil {
+		return fmt.Errorf("failed to merge account partitions: %w", err)
+	}
 
-			accountsIncreased := len(accounts) - lastAccountCount
-			lastAccountCount = len(accounts)
-			accountPerMillisec := float64(accountsIncreased) / float64(time.Since(lastTime).Milliseconds())
-			log.Printf("Accounts per second: %.2f\n", accountPerMillisec*1000)
+	totals := checkpoint.totals()
 
-			log.Printf("===========================================\n")
-			lastTime = time.Now()
-		}
+	if partial {
+		log.Printf("\nReached the maximum number of accounts, the output is PARTIAL\n")
+		log.Printf("Checkpoint kept at %s: raise max_accounts and use --resume to continue\n", checkpointPath)
+	} else {
+		// The output is complete, the checkpoint is no longer needed
+		os.Remove(checkpointPath)
 
-		// Flush if the estimated in-memory size exceeds the threshold.
-		currMemoryBytes := len(accounts) * int(unsafe.Sizeof(RpcAccount{}))
-		if currMemoryBytes >= flushThresholdBytes {
-			totalAccounts += len(accounts)
-			if err := flushAccounts(); err != nil {
-				return err
-			}
-		}
+		log.Printf("\nTask completed successfully!\n")
 	}
 
-	// Flush any remaining accounts.
-	if len(accounts) > 0 {
-		totalAccounts += len(accounts)
-		chunkFileName := fmt.Sprintf("%s_%d.json", baseOutputFileName, len(chunkFiles)+1)
-		filePath := fmt.Sprintf("%s/%s", config.Scan.OutputDir, chunkFileName)
-		if err := SaveStructToJSONFile(accounts, filePath); err != nil {
-			return fmt.Errorf("failed to save remaining accounts to file: %w", err)
-		}
-		log.Printf("Flushed final %d accounts to file: %s\n", len(accounts), filePath)
-		chunkFiles = append(chunkFiles, filePath)
+	log.Printf("Accounts saved to %s: %d accounts, %d bytes\n", filePath, totals.WrittenAccounts, totals.OutputBytes)
+	log.Printf("Total accounts scanned: %d in %d pages\n", totals.ScannedAccounts, totals.Pages)
+	log.Printf("Total contracts: %d\n", totals.Contracts)
+	log.Printf("Total non-contracts: %d\n", totals.NonContracts)
+
+	endKey := "the end of the key space"
+	if checkpoint.EndKey != "" {
+		endKey = fmt.Sprintf("key %q", checkpoint.EndKey)
 	}
 
-	// At this point, multiple chunk files have been created.
-	// Now merge them into one final file.
-	if len(chunkFiles) > 0 {
-		mergedAccounts := make(map[string]RpcAccount)
-		for _, chunkFile := range chunkFiles {
-			data, err := os.ReadFile(chunkFile)
-			if err != nil {
-				return fmt.Errorf("failed to read chunk file %s: %w", chunkFile, err)
-			}
-			var chunkData map[string]RpcAccount
-			if err := json.Unmarshal(data, &chunkData); err != nil {
-				return fmt.Errorf("failed to unmarshal chunk file %s: %w", chunkFile, err)
-			}
-			for k, v := range chunkData {
-				mergedAccounts[k] = v
-			}
-		}
-		mergedFile := fmt.Sprintf("%s/%s_merged.json", config.Scan.OutputDir, baseOutputFileName)
-		if err := SaveStructToJSONFile(mergedAccounts, mergedFile); err != nil {
-			return fmt.Errorf("failed to save merged accounts to file: %w", err)
-		}
-		log.Printf("Merged %d chunk files into final file: %s\n", len(chunkFiles), mergedFile)
+	if uncovered := uncoveredAccountKeys(checkpoint.Partitions); uncovered != "" {
+		log.Printf("Key space NOT fully covered, %s\n", uncovered)
 	} else {
-		// No chunk files were written so far. This means no flush was needed,
-		// and you already have the complete data in memory.
-		mergedFile := fmt.Sprintf("%s/%s.json", config.Scan.OutputDir, baseOutputFileName)
-		if err := SaveStructToJSONFile(accounts, mergedFile); err != nil {
-			return fmt.Errorf("failed to save accounts to file: %w", err)
-		}
-		log.Printf("Accounts saved to final file: %s\n", mergedFile)
+		log.Printf("Key space fully covered: from key %q to %s\n", checkpoint.StartKey, endKey)
 	}
-
-	log.Printf("\nTask completed successfully!\n")
-	log.Printf("Total contracts: %d\n", numContracts)
-	log.Printf("Total non-contracts: %d\n", numNonContracts)
-	log.Printf("Last scan key: %s\n", scanKey)
 	return nil
 }
 
 type AccountWithBalanceAndCode struct {
-	Address string  `json:"address"`
-	Balance float64 `json:"balance (ether)"`
-	Code    string  `json:"code"`
+	Address     string  `json:"address"`
+	Balance     float64 `json:"balance (ether)"`
+	Code        string  `json:"code"`
+	IsContract  bool    `json:"isContract"`
+	DelegatedTo string  `json:"delegatedTo,omitempty"` // Target of an EIP-7702 delegation designator
 }
 
 func ScanContractCode(config *Config, accountsFile string) error {
@@ -553,12 +1039,14 @@ func ScanContractCode(config *Config, accountsFile string) error {
 
 	log.Printf("Loaded %d accounts from file: %s\n", len(accounts), accountsFile)
 
-	client, err := GetRpcClient(config.Rpc.Url)
+	client, err := NewRpcPool(config.Rpc)
 
 	if err != nil {
 		return fmt.Errorf("failed to create RPC client: %w", err)
 	}
 
+	defer client.Close()
+
 	batchSize := config.Scan.ContractCodeScanConfig.BatchSize
 	batchCount := len(accounts) / int(batchSize)
 
@@ -569,7 +1057,8 @@ func ScanContractCode(config *Config, accountsFile string) error {
 	log.Printf("Batch size: %d\n", batchSize)
 	log.Printf("Total accounts to scan: %d\n", len(accounts))
 	log.Printf("Total batches: %d\n", batchCount)
-	log.Printf("Delay between requests: %d ms\n", config.Rpc.Delay)
+	log.Printf("Workers: %d\n", config.Rpc.workerCount())
+	log.Printf("Rate limit: %s\n", client.Limiter())
 
 	bar := progressbar.NewOptions64(int64(batchCount),
 		progressbar.OptionSetDescription("Fetching contract code..."),
@@ -577,7 +1066,14 @@ func ScanContractCode(config *Config, accountsFile string) error {
 		progressbar.OptionSetWidth(20),
 	)
 
-	for i := 0; i < batchCount; i++ {
+	failures := make([]FailedRequest, 0)
+
+	type codesBatchResult struct {
+		codes    []ContractCode
+		failures []FailedRequest
+	}
+
+	batchAddresses := func(i int) (int, []string) {
 		batchStart := i * int(batchSize)
 		batchEnd := batchStart + int(batchSize)
 
@@ -587,32 +1083,64 @@ func ScanContractCode(config *Config, accountsFile string) error {
 
 		currentBatch := accounts[batchStart:batchEnd]
 
-		bar.Describe(fmt.Sprintf("Fetching contract code for accounts %d to %d", batchStart, batchEnd))
-
 		addresses := make([]string, len(currentBatch))
 		for j, account := range currentBatch {
 			addresses[j] = account.Address
 		}
 
-		batchCodes, err := GetContractCodeBatch(client, addresses)
-		// Add a delay between requests
-		time.Sleep(time.Duration(config.Rpc.Delay) * time.Millisecond)
+		return batchStart, addresses
+	}
 
-		if err != nil {
-			bar.Add(1)
-			return fmt.Errorf("failed to fetch contract code: %w", err)
+	sizer := NewAdaptiveBatchSize(batchSize)
+
+	fetchBatch := func(i int) codesBatchResult {
+		_, addresses := batchAddresses(i)
+
+		batchCodes, batchFailures := GetContractCodeBatch(client, addresses, config.Rpc.Retry, sizer)
+
+		return codesBatchResult{codes: batchCodes, failures: batchFailures}
+	}
+
+	handleBatch := func(i int, result codesBatchResult) error {
+		batchStart, addresses := batchAddresses(i)
+		batchCodes := result.codes
+
+		bar.Describe(fmt.Sprintf("Fetched contract code for accounts %d to %d (batch: %d)", batchStart, batchStart+len(addresses), sizer.Size()))
+
+		failures = append(failures, result.failures...)
+
+		// Failed addresses are missing from batchCodes, so match the codes by address.
+		codesByAddress := make(map[string]string, len(batchCodes))
+		for _, code := range batchCodes {
+			codesByAddress[code.Address] = code.Code
 		}
 
-		for j, code := range batchCodes {
+		for j, address := range addresses {
+			code, ok := codesByAddress[address]
+			if !ok {
+				continue
+			}
+
 			// Update the original account with the fetched code.
-			if code.Code != "" {
-				accounts[batchStart+j].Code = code.Code
+			if code != "" {
+				accounts[batchStart+j].Code = code
 			} else {
 				accounts[batchStart+j].Code = "0x"
 			}
+
+			// A delegated EOA has a delegation designator as code but is not a contract.
+			delegatedTo, delegated := ParseDelegation(accounts[batchStart+j].Code)
+			accounts[batchStart+j].DelegatedTo = delegatedTo
+			accounts[batchStart+j].IsContract = !delegated && accounts[batchStart+j].Code != "0x"
 		}
 
 		bar.Add(1)
+
+		return nil
+	}
+
+	if err := RunBatches(batchCount, config.Rpc.workerCount(), fetchBatch, handleBatch); err != nil {
+		return err
 	}
 
 	// Save accounts with contract code to file
@@ -622,5 +1150,15 @@ func ScanContractCode(config *Config, accountsFile string) error {
 		return fmt.Errorf("failed to save contract codes to file: %w", err)
 	}
 
+	failuresPath := fmt.Sprintf("%s/failed_%s", config.Scan.OutputDir, config.Scan.ContractCodeScanConfig.OutputFileName)
+
+	if err := SaveFailedRequests(failures, failuresPath); err != nil {
+		return err
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("output %s is incomplete: %d requests failed, see %s", filePath, len(failures), failuresPath)
+	}
+
 	return nil
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// TraceOptions are the tracing options of a debug_traceBlockByHash request.
+type TraceOptions struct {
+	Tracer  string `json:"tracer"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ScanTracesWithConfig traces the transactions of the block range of the
+// configuration with the callTracer and streams their call frames, flattened
+// into internal transactions, to a JSON lines file. With an address filter,
+// only the calls from or to one of the addresses are saved.
+func ScanTracesWithConfig(config *Config, resume bool) error {
+	if err := validateConfig(config); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	batchSize := config.Scan.TraceScanConfig.BatchSize
+
+	if batchSize == 0 {
+		return fmt.Errorf("invalid configuration: trace_scan.batch_size must be greater than 0")
+	}
+
+	log.Printf("Starting the trace scanner...\n")
+
+	startBlock := config.Scan.FromBlock
+	endBlock := config.Scan.ToBlock
+
+	totalBlocks := endBlock - startBlock + 1
+	batchCount := totalBlocks / batchSize
+
+	if totalBlocks%batchSize != 0 {
+		batchCount++
+	}
+
+	log.Printf("Total blocks to trace: %d\n", totalBlocks)
+	log.Printf("Batch size: %d\n", batchSize)
+	log.Printf("Workers: %d\n", config.Rpc.workerCount())
+
+	baseName := fmt.Sprintf("traces_%d_to_%d", startBlock, endBlock)
+	filePath := fmt.Sprintf("%s/%s.jsonl", config.Scan.OutputDir, baseName)
+	checkpointPath := fmt.Sprintf("%s/%s.checkpoint.json", config.Scan.OutputDir, baseName)
+
+	checkpoint := newTraceScanCheckpoint(config)
+
+	if resume {
+		loaded, err := LoadTraceScanCheckpoint(checkpointPath)
+		if err != nil {
+			return err
+		}
+
+		if err := loaded.matches(config); err != nil {
+			return fmt.Errorf("cannot resume: %w", err)
+		}
+
+		checkpoint = loaded
+		log.Printf("Resuming from checkpoint %s: %d of %d batches already done\n", checkpointPath, checkpoint.CompletedBatches, batchCount)
+	}
+
+	writer, err := OpenJSONLWriter(filePath, checkpoint.OutputBytes)
+	if err != nil {
+		return fmt.Errorf("failed to open traces output: %w", err)
+	}
+
+	defer writer.Close()
+
+	// The state as of the last fully handled batch. Only this state is saved,
+	// so that a batch that failed half way is fetched again on resume.
+	completed := *checkpoint
+
+	saveCheckpoint := func() error {
+		if _, err := writer.Sync(); err != nil {
+			return fmt.Errorf("failed to save traces output: %w", err)
+		}
+
+		completed.UpdatedAt = time.Now().Unix()
+
+		return SaveCheckpoint(&completed, checkpointPath)
+	}
+
+	if err := saveCheckpoint(); err != nil {
+		return err
+	}
+
+	client, err := NewRpcPool(config.Rpc)
+
+	if err != nil {
+		return fmt.Errorf("failed to create RPC client: %w", err)
+	}
+
+	defer client.Close()
+
+	log.Printf("Connected to RPC servers: %s\n", strings.Join(client.Urls(), ", "))
+	log.Printf("Rate limit: %s\n", client.Limiter())
+
+	bar := progressbar.NewOptions64(int64(batchCount),
+		progressbar.OptionSetDescription("Tracing blocks..."),
+		progressbar.OptionSetWriter(log.Writer()),
+		progressbar.OptionSetWidth(20),
+	)
+
+	bar.Set64(int64(checkpoint.CompletedBatches))
+
+	// Batches are numbered from the first batch not done yet
+	firstBatch := checkpoint.CompletedBatches
+
+	batchBlocks := func(i int) []*big.Int {
+		batchStart := startBlock + (firstBatch+uint64(i))*batchSize
+		batchEnd := batchStart + batchSize - 1
+
+		if batchEnd > endBlock {
+			batchEnd = endBlock
+		}
+
+		blocks := make([]*big.Int, 0, batchEnd-batchStart+1)
+
+		for number := batchStart; number <= batchEnd; number++ {
+			blocks = append(blocks, new(big.Int).SetUint64(number))
+		}
+
+		return blocks
+	}
+
+	type tracesBatchResult struct {
+		traces   []RpcBlockTraces
+		failures []FailedRequest
+	}
+
+	options := TraceOptions{Tracer: "callTracer", Timeout: config.Scan.TraceScanConfig.Timeout}
+	// Each block is traced with a second request for its transaction hashes
+	sizer := NewAdaptiveBatchSize(2 * batchSize)
+	checkpointInterval := config.Scan.BlockScanConfig.checkpointInterval()
+
+	fetchBatch := func(i int) tracesBatchResult {
+		batchTraces, batchFailures := GetBlockTracesBatch(client, batchBlocks(i), options, config.Rpc.Retry, sizer)
+
+		return tracesBatchResult{traces: batchTraces, failures: batchFailures}
+	}
+
+	handleBatch := func(i int, result tracesBatchResult) error {
+		checkpoint.Failures = append(checkpoint.Failures, result.failures...)
+
+		for _, blockTraces := range result.traces {
+			for index, trace := range blockTraces.Traces {
+				calls, err := FlattenTransactionTrace(blockTraces.BlockNumber, index, blockTraces.TransactionHashes[index], &trace)
+
+				if err != nil {
+					return fmt.Errorf("failed to convert the traces of block %s: %w", blockTraces.BlockNumber, err)
+				}
+
+				for _, call := range calls {
+					creation := call.Type == "CREATE" || call.Type == "CREATE2"
+
+					if len(config.Filter.Addresses) > 0 && !matchesAddressFilter(config.Filter.Addresses, call.From, call.To, creation) {
+						continue
+					}
+
+					if err := writer.Write(call); err != nil {
+						return fmt.Errorf("failed to save internal transaction: %w", err)
+					}
+
+					checkpoint.CallCount++
+				}
+			}
+
+			checkpoint.TxCount += uint64(len(blockTraces.Traces))
+			checkpoint.BlockCount++
+		}
+
+		checkpoint.CompletedBatches++
+		checkpoint.OutputBytes = writer.Offset()
+		completed = *checkpoint
+
+		if checkpoint.CompletedBatches%checkpointInterval == 0 {
+			if err := saveCheckpoint(); err != nil {
+				return err
+			}
+		}
+
+		bar.Describe(fmt.Sprintf("Txs: %d, Calls: %d, Success (Block): %d Fail (Request): %d Batch: %d", checkpoint.TxCount, checkpoint.CallCount, checkpoint.BlockCount, len(checkpoint.Failures), sizer.Size()))
+		bar.Add(1)
+
+		return nil
+	}
+
+	if err := RunBatches(int(batchCount-firstBatch), config.Rpc.workerCount(), fetchBatch, handleBatch); err != nil {
+		if checkpointErr := saveCheckpoint(); checkpointErr != nil {
+			log.Printf("failed to save checkpoint: %v", checkpointErr)
+		}
+		return err
+	}
+
+	if err := saveCheckpoint(); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to close traces output: %w", err)
+	}
+
+	failuresPath := fmt.Sprintf("%s/failed_traces_%d_to_%d.json", config.Scan.OutputDir, startBlock, endBlock)
+
+	if err := SaveFailedRequests(checkpoint.Failures, failuresPath); err != nil {
+		return err
+	}
+
+	// The output is complete, the checkpoint is no longer needed
+	os.Remove(checkpointPath)
+
+	bar.Finish()
+
+	log.Printf("\nTask completed successfully!\n")
+	log.Printf("%d internal transactions of %d transactions in %d blocks saved to %s.\n", checkpoint.CallCount, checkpoint.TxCount, checkpoint.BlockCount, filePath)
+
+	if len(checkpoint.Failures) > 0 {
+		return fmt.Errorf("output %s is incomplete: %d requests failed, see %s", filePath, len(checkpoint.Failures), failuresPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testTraceBlock is a block of testTraceService. The traces of its
+// transactions have no hash, like those of older nodes, but carry the value
+// of the block so that they can be told apart.
+type testTraceBlock struct {
+	hash         string
+	value        string
+	transactions []string
+}
+
+// testTraceService answers eth_getBlockByNumber and debug_traceBlockByHash.
+// A block number with a reorg is replaced by another block once it was
+// fetched, as on a node that switched to another fork in between.
+type testTraceService struct {
+	mu     sync.Mutex
+	blocks map[uint64]testTraceBlock
+	reorgs map[uint64]testTraceBlock
+	byHash map[string]testTraceBlock
+}
+
+func newTestTraceService() *testTraceService {
+	return &testTraceService{
+		blocks: make(map[uint64]testTraceBlock),
+		reorgs: make(map[uint64]testTraceBlock),
+		byHash: make(map[string]testTraceBlock),
+	}
+}
+
+func (s *testTraceService) addBlock(blocks map[uint64]testTraceBlock, number uint64, value string, transactions int) {
+	block := testTraceBlock{
+		hash:  fmt.Sprintf("0x%064x", len(s.byHash)+1),
+		value: value,
+	}
+
+	for i := 0; i < transactions; i++ {
+		block.transactions = append(block.transactions, fmt.Sprintf("0x%062x%02x", len(s.byHash)+1, i))
+	}
+
+	blocks[number] = block
+	s.byHash[block.hash] = block
+}
+
+func (s *testTraceService) BlockNumber() hexutil.Uint64 {
+	return 1_000_000
+}
+
+func (s *testTraceService) GetBlockByNumber(number string, full bool) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, err := hexutil.DecodeUint64(number)
+	if err != nil {
+		return nil, err
+	}
+
+	block, ok := s.blocks[n]
+	if !ok {
+		return nil, nil
+	}
+
+	if reorg, ok := s.reorgs[n]; ok {
+		s.blocks[n] = reorg
+	}
+
+	return map[string]any{"hash": block.hash, "transactions": block.transactions}, nil
+}
+
+func (s *testTraceService) TraceBlockByHash(hash string, options TraceOptions) ([]RpcTransactionTrace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	block, ok := s.byHash[hash]
+	if !ok {
+		return nil, fmt.Errorf("block %s not found", hash)
+	}
+
+	traces := make([]RpcTransactionTrace, 0, len(block.transactions))
+
+	for range block.transactions {
+		traces = append(traces, RpcTransactionTrace{
+			Result: &RpcCallFrame{Type: "CALL", From: "0x" + strings.Repeat("aa", 20), To: "0x" + strings.Repeat("bb", 20), Value: block.value},
+		})
+	}
+
+	return traces, nil
+}
+
+func TestGetBlockTracesBatch(t *testing.T) {
+	service := newTestTraceService()
+	service.addBlock(service.blocks, 1, "0x1", 2)
+	service.addBlock(service.blocks, 2, "0x1", 0)
+	service.addBlock(service.blocks, 3, "0x1", 3)
+	service.addBlock(service.reorgs, 3, "0x2", 1)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.RegisterName("debug", service); err != nil {
+		t.Fatal(err)
+	}
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	defer server.Stop()
+
+	client, err := NewRpcPool(RpcConfig{Url: httpServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	blocks := []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3), big.NewInt(4)}
+	retry := RetryConfig{MaxAttempts: 1, InitialBackoff: 1, MaxBackoff: 1}
+
+	responses, failures := GetBlockTracesBatch(client, blocks, TraceOptions{Tracer: "callTracer"}, retry, NewAdaptiveBatchSize(3))
+
+	// Block 3 is traced as the block of its transaction hashes, not as the
+	// block that replaced it.
+	got := make([]string, 0)
+
+	for _, response := range responses {
+		for index, trace := range response.Traces {
+			calls, err := FlattenTransactionTrace(response.BlockNumber, index, response.TransactionHashes[index], &trace)
+			if err != nil {
+				t.Fatalf("block %s: %v", response.BlockNumber, err)
+			}
+
+			got = append(got, fmt.Sprintf("%s/%d %v", response.BlockNumber, index, calls[0].Value))
+		}
+	}
+
+	want := []string{"1/0 1", "1/1 1", "3/0 1", "3/1 1", "3/2 1"}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("traces %v, want %v", got, want)
+	}
+
+	if len(responses) != 3 {
+		t.Errorf("%d blocks traced, want 3", len(responses))
+	}
+
+	if len(failures) != 1 || failures[0].Method != "eth_getBlockByNumber" {
+		t.Errorf("failures %+v, want the missing block", failures)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// TransactionMismatch is a field of a scanned transaction that does not match
+// the value recomputed from the signed transaction.
+type TransactionMismatch struct {
+	BlockNumber *big.Int `json:"blockNumber"`
+	Hash        string   `json:"hash"`
+	Field       string   `json:"field"`           // "hash", "from" or "chainId", or "transaction" when it cannot be rebuilt
+	Node        string   `json:"node"`            // Value returned by the node
+	Computed    string   `json:"computed"`        // Value recomputed from the signed transaction
+	Error       string   `json:"error,omitempty"` // Why the value could not be recomputed
+}
+
+// transactionSigner returns the signer of the transaction type and chain ID.
+// Legacy transactions without replay protection are signed for any chain.
+func transactionSigner(tx *types.Transaction) types.Signer {
+	if !tx.Protected() {
+		return types.HomesteadSigner{}
+	}
+
+	return types.LatestSignerForChainID(tx.ChainId())
+}
+
+// VerifyTransaction rebuilds a scanned transaction, recomputes its hash and
+// recovers its sender, and returns the fields that do not match.
+func VerifyTransaction(tx *TransactionFull) []TransactionMismatch {
+	mismatch := func(field string, node string, computed string, err error) TransactionMismatch {
+		result := TransactionMismatch{BlockNumber: tx.BlockNumber, Hash: tx.Hash, Field: field, Node: node, Computed: computed}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		return result
+	}
+
+	signed, err := TransactionFullToNative(tx)
+	if err != nil {
+		return []TransactionMismatch{mismatch("transaction", "", "", err)}
+	}
+
+	var mismatches []TransactionMismatch
+
+	if hash := signed.Hash().Hex(); !strings.EqualFold(hash, tx.Hash) {
+		mismatches = append(mismatches, mismatch("hash", tx.Hash, hash, nil))
+	}
+
+	// The chain ID of a legacy transaction is derived from V, it must agree with the one returned by the node.
+	if signed.Type() == types.LegacyTxType && signed.Protected() && (tx.ChainId == nil || tx.ChainId.Cmp(signed.ChainId()) != 0) {
+		node := ""
+		if tx.ChainId != nil {
+			node = tx.ChainId.String()
+		}
+
+		mismatches = append(mismatches, mismatch("chainId", node, signed.ChainId().String(), nil))
+	}
+
+	sender, err := types.Sender(transactionSigner(signed), signed)
+	if err != nil {
+		mismatches = append(mismatches, mismatch("from", tx.From, "", err))
+	} else if !strings.EqualFold(sender.Hex(), tx.From) {
+		mismatches = append(mismatches, mismatch("from", tx.From, addressToString(sender), nil))
+	}
+
+	return mismatches
+}
+
+// BlockMismatch is a field of a scanned block that does not match the value
+// recomputed from the block, its transactions or its receipts.
+type BlockMismatch struct {
+	BlockNumber *big.Int `json:"blockNumber"`
+	BlockHash   string   `json:"blockHash"`
+	Field       string   `json:"field"`           // "hash", "transactionsRoot", "receiptsRoot" or "receipts" when some are missing
+	Exported    string   `json:"exported"`        // Value in the scanned block
+	Computed    string   `json:"computed"`        // Value recomputed from the scanned data
+	Error       string   `json:"error,omitempty"` // Why the value could not be recomputed
+}
+
+// VerifyBlock recomputes the hash and transactions root of a scanned block and
+// returns the fields that do not match. The receipts root is only checked when
+// receipts is not nil, in which case it must hold the receipts of all transactions.
+func VerifyBlock(block *BlockFull, receipts []Receipt) []BlockMismatch {
+	mismatch := func(field string, exported string, computed string, err error) BlockMismatch {
+		result := BlockMismatch{BlockNumber: block.Number, BlockHash: block.Hash, Field: field, Exported: exported, Computed: computed}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		return result
+	}
+
+	var mismatches []BlockMismatch
+
+	header, err := BlockFullToHeader(block)
+	if err != nil {
+		mismatches = append(mismatches, mismatch("hash", block.Hash, "", err))
+	} else if hash := header.Hash().Hex(); !strings.EqualFold(hash, block.Hash) {
+		mismatches = append(mismatches, mismatch("hash", block.Hash, hash, nil))
+	}
+
+	transactions := make(types.Transactions, 0, len(block.Transactions))
+
+	for _, tx := range block.Transactions {
+		signed, err := TransactionFullToNative(&tx)
+		if err != nil {
+			mismatches = append(mismatches, mismatch("transactionsRoot", block.TransactionsRoot, "", fmt.Errorf("transaction %s: %w", tx.Hash, err)))
+			transactions = nil
+			break
+		}
+
+		transactions = append(transactions, signed)
+	}
+
+	if transactions != nil {
+		root := types.DeriveSha(transactions, trie.NewStackTrie(nil)).Hex()
+		if !strings.EqualFold(root, block.TransactionsRoot) {
+			mismatches = append(mismatches, mismatch("transactionsRoot", block.TransactionsRoot, root, nil))
+		}
+	}
+
+	if receipts == nil {
+		return mismatches
+	}
+
+	if len(receipts) != len(block.Transactions) {
+		return append(mismatches, mismatch("receipts", fmt.Sprint(len(block.Transactions)), fmt.Sprint(len(receipts)),
+			fmt.Errorf("found %d receipts for %d transactions", len(receipts), len(block.Transactions))))
+	}
+
+	// The receipts trie is keyed by transaction index.
+	sorted := slices.Clone(receipts)
+	slices.SortFunc(sorted, func(a, b Receipt) int {
+		return cmpBigInt(a.TransactionIndex, b.TransactionIndex)
+	})
+
+	nativeReceipts := make(types.Receipts, len(sorted))
+
+	for i := range sorted {
+		receipt, err := ReceiptToNative(&sorted[i])
+		if err != nil {
+			return append(mismatches, mismatch("receiptsRoot", block.ReceiptsRoot, "", err))
+		}
+
+		nativeReceipts[i] = receipt
+	}
+
+	root := types.DeriveSha(nativeReceipts, trie.NewStackTrie(nil)).Hex()
+	if !strings.EqualFold(root, block.ReceiptsRoot) {
+		mismatches = append(mismatches, mismatch("receiptsRoot", block.ReceiptsRoot, root, nil))
+	}
+
+	return mismatches
+}
+
+// cmpBigInt compares two optional integers, nil first.
+func cmpBigInt(a *big.Int, b *big.Int) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	return a.Cmp(b)
+}
+
+// VerificationReport lists the mismatches found in a scanned range.
+type VerificationReport struct {
+	FromBlock             uint64                `json:"fromBlock"`
+	ToBlock               uint64                `json:"toBlock"`
+	VerifiedBlocks        int                   `json:"verifiedBlocks"`
+	VerifiedReceipts      bool                  `json:"verifiedReceipts"`
+	VerifiedTransactions  int                   `json:"verifiedTransactions"`
+	BlockMismatches       []BlockMismatch       `json:"blockMismatches"`
+	TransactionMismatches []TransactionMismatch `json:"transactionMismatches"`
+}
+
+// Mismatches returns the total number of mismatches of the report.
+func (r *VerificationReport) Mismatches() int {
+	return len(r.BlockMismatches) + len(r.TransactionMismatches)
+}
+
+// VerifyBlocksWithConfig verifies a block scan output (a JSON file or a JSON
+// lines manifest) and, if receiptsFile is not empty, the receipts scanned for
+// it. The report is saved in the output directory. Blocks scanned with an
+// address filter lack transactions and fail the transactions root check.
+func VerifyBlocksWithConfig(config *Config, blockFile string, receiptsFile string) error {
+	log.Printf("Starting the verification of %s...\n", blockFile)
+
+	var receiptsByBlock map[string][]Receipt
+
+	if receiptsFile != "" {
+		var receipts []Receipt
+
+		if err := JSONToStruct(receiptsFile, &receipts); err != nil {
+			return fmt.Errorf("failed to load receipts from file: %w", err)
+		}
+
+		receiptsByBlock = make(map[string][]Receipt)
+		for _, receipt := range receipts {
+			blockHash := strings.ToLower(receipt.BlockHash)
+			receiptsByBlock[blockHash] = append(receiptsByBlock[blockHash], receipt)
+		}
+
+		log.Printf("Loaded %d receipts of %d blocks from %s\n", len(receipts), len(receiptsByBlock), receiptsFile)
+	}
+
+	report := &VerificationReport{
+		VerifiedReceipts:      receiptsFile != "",
+		BlockMismatches:       make([]BlockMismatch, 0),
+		TransactionMismatches: make([]TransactionMismatch, 0),
+	}
+
+	err := ReadBlocks(blockFile, func(block *BlockFull) error {
+		var receipts []Receipt
+		if receiptsByBlock != nil {
+			receipts = receiptsByBlock[strings.ToLower(block.Hash)]
+			if receipts == nil {
+				receipts = []Receipt{}
+			}
+		}
+
+		report.BlockMismatches = append(report.BlockMismatches, VerifyBlock(block, receipts)...)
+
+		for _, tx := range block.Transactions {
+			report.TransactionMismatches = append(report.TransactionMismatches, VerifyTransaction(&tx)...)
+		}
+
+		if block.Number != nil {
+			number := block.Number.Uint64()
+			if report.VerifiedBlocks == 0 || number < report.FromBlock {
+				report.FromBlock = number
+			}
+			if number > report.ToBlock {
+				report.ToBlock = number
+			}
+		}
+
+		report.VerifiedBlocks++
+		report.VerifiedTransactions += len(block.Transactions)
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if report.VerifiedBlocks == 0 {
+		return fmt.Errorf("no blocks found in %s", blockFile)
+	}
+
+	reportPath := fmt.Sprintf("%s/verification_%d_to_%d.json", config.Scan.OutputDir, report.FromBlock, report.ToBlock)
+
+	if err := SaveStructToJSONFile(report, reportPath); err != nil {
+		return fmt.Errorf("failed to save verification report: %w", err)
+	}
+
+	log.Printf("Verified %d blocks and %d transactions: %d block mismatches, %d transaction mismatches\n",
+		report.VerifiedBlocks, report.VerifiedTransactions, len(report.BlockMismatches), len(report.TransactionMismatches))
+	log.Printf("Verification report saved to %s\n", reportPath)
+
+	if report.Mismatches() > 0 {
+		return fmt.Errorf("%d mismatches found, see %s", report.Mismatches(), reportPath)
+	}
+
+	return nil
+}
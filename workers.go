@@ -0,0 +1,111 @@
+package main
+
+import "sync"
+
+// workerCount returns the configured number of workers, falling back to the default.
+func (r RpcConfig) workerCount() int {
+	if r.Workers == 0 {
+		return DefaultWorkers
+	}
+
+	return int(r.Workers)
+}
+
+// RunBatches fetches batches 0..batchCount-1 on the given number of workers and
+// passes the results to handle in batch order. At most two batches per worker
+// are in flight ahead of the next batch to handle, which bounds memory usage.
+// The first error returned by handle stops the dispatching and is returned.
+func RunBatches[T any](batchCount int, workers int, fetch func(i int) T, handle func(i int, result T) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	type batchResult struct {
+		index  int
+		result T
+	}
+
+	window := make(chan struct{}, workers*2)
+	jobs := make(chan int)
+	results := make(chan batchResult)
+	done := make(chan struct{})
+
+	// Dispatcher
+	go func() {
+		defer close(jobs)
+
+		for i := 0; i < batchCount; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// Workers
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				result := fetch(i)
+
+				select {
+				case results <- batchResult{index: i, result: result}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Reassemble the results in batch order
+	pending := make(map[int]T)
+	next := 0
+
+	var handleErr error
+
+	for res := range results {
+		if handleErr != nil {
+			continue
+		}
+
+		pending[res.index] = res.result
+
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+
+			delete(pending, next)
+
+			if err := handle(next, result); err != nil {
+				handleErr = err
+				close(done)
+				break
+			}
+
+			next++
+			<-window
+		}
+	}
+
+	return handleErr
+}
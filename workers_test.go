@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunBatches(t *testing.T) {
+	handleErr := errors.New("handle failed")
+
+	tests := []struct {
+		name      string
+		batches   int
+		workers   int
+		failAt    int // Batch whose handling fails, -1 when none fails
+		wantOrder []int
+		wantErr   error
+	}{
+		{name: "no batches", batches: 0, workers: 4, failAt: -1, wantOrder: []int{}},
+		{name: "single worker", batches: 5, workers: 1, failAt: -1, wantOrder: []int{0, 1, 2, 3, 4}},
+		{name: "more workers than batches", batches: 3, workers: 8, failAt: -1, wantOrder: []int{0, 1, 2}},
+		{name: "invalid worker count", batches: 3, workers: 0, failAt: -1, wantOrder: []int{0, 1, 2}},
+		{name: "out of order completion", batches: 20, workers: 4, failAt: -1, wantOrder: sequence(20)},
+		{name: "handle error", batches: 20, workers: 4, failAt: 6, wantOrder: sequence(7), wantErr: handleErr},
+		{name: "first batch fails", batches: 20, workers: 2, failAt: 0, wantOrder: []int{0}, wantErr: handleErr},
+	}
+
+	for _, test := range tests {
+		var fetched atomic.Int64
+
+		handled := make([]int, 0)
+
+		fetch := func(i int) int {
+			fetched.Add(1)
+			// Later batches complete first.
+			time.Sleep(time.Duration(test.batches-i) * time.Millisecond)
+			return i * 10
+		}
+
+		handle := func(i int, result int) error {
+			if result != i*10 {
+				t.Errorf("%s: batch %d got the result %d of another batch", test.name, i, result)
+			}
+
+			handled = append(handled, i)
+
+			if i == test.failAt {
+				return handleErr
+			}
+
+			return nil
+		}
+
+		err := RunBatches(test.batches, test.workers, fetch, handle)
+
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.wantErr)
+		}
+
+		if !slices.Equal(handled, test.wantOrder) {
+			t.Errorf("%s: handled %v, want %v", test.name, handled, test.wantOrder)
+		}
+
+		// The dispatching stops once a batch fails, so only the batches in the
+		// window of the failed one can have been fetched.
+		workers := max(test.workers, 1)
+		if test.failAt >= 0 && fetched.Load() > int64(test.failAt+1+workers*2) {
+			t.Errorf("%s: %d batches fetched after the failure of batch %d", test.name, fetched.Load(), test.failAt)
+		}
+	}
+}
+
+func sequence(n int) []int {
+	values := make([]int, n)
+	for i := range values {
+		values[i] = i
+	}
+
+	return values
+}